@@ -1,8 +1,13 @@
 package api
 
 import (
+    "encoding/hex"
+    "errors"
+    "net/http"
+    "strconv"
+    "time"
 
-    "time" 
+    "aetherchain/crypto"
 )
 
 import "github.com/gin-gonic/gin"
@@ -35,11 +40,14 @@ func (s *Server) setupRoutes() {
 			blockchain.GET("/blocks", s.getBlocks)
 			blockchain.GET("/blocks/:height", s.getBlockByHeight)
 			blockchain.GET("/blocks/hash/:hash", s.getBlockByHash)
+			blockchain.GET("/blocks/:height/proof/:tx_hash", s.getMerkleProof)
 			blockchain.GET("/transactions/pending", s.getPendingTransactions)
 			blockchain.GET("/transactions/:hash", s.getTransaction)
 			blockchain.POST("/transactions", s.createTransaction)
 			blockchain.GET("/balance/:address", s.getBalance)
+			blockchain.GET("/nonce/:address", s.getNonce)
 			blockchain.GET("/validity", s.checkChainValidity)
+			blockchain.GET("/reorgs", s.getReorgs)
 		}
 
 		// Mining endpoints
@@ -48,6 +56,7 @@ func (s *Server) setupRoutes() {
 			mining.GET("/mine", s.mineBlock)
 			mining.GET("/status", s.getMiningStatus)
 			mining.GET("/reward", s.getBlockReward)
+			mining.GET("/supply", s.getSupply)
 		}
 
 		// Network endpoints
@@ -56,6 +65,9 @@ func (s *Server) setupRoutes() {
 			network.GET("/info", s.getNetworkInfo)
 			network.GET("/peers", s.getPeers)
 			network.POST("/peers", s.addPeer)
+			network.GET("/peers/banned", s.getBannedPeers)
+			network.POST("/peers/ban", s.banPeer)
+			network.DELETE("/peers/ban/:address", s.unbanPeer)
 			network.GET("/discovery", s.getDiscoveredPeers)
 			network.GET("/stats", s.getNetworkStats)
 		}
@@ -73,6 +85,7 @@ func (s *Server) setupRoutes() {
 		wallet := apiV1.Group("/wallet")
 		{
 			wallet.POST("/create", s.createWallet)
+			wallet.POST("/unlock", s.unlockWallet)
 			wallet.GET("/addresses", s.getAddresses)
 		}
 	}
@@ -103,6 +116,54 @@ func (s *Server) healthCheck(c *gin.Context) {
 	})
 }
 
+// getMerkleProof returns the inclusion proof of a transaction in a block,
+// looked up by its transaction hash or witness hash. The leaf of the proof is
+// the witness hash, so the serialized transaction is returned with it: a
+// client must recompute the leaf as the SHA-256 of the decoded transaction
+// and check the transaction hash it expects rather than trust witness_hash.
+func (s *Server) getMerkleProof(c *gin.Context) {
+	height, err := strconv.Atoi(c.Param("height"))
+	if err != nil {
+		height = -1
+	}
+	block := s.blockchain.GetBlockByIndex(height)
+	if block == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid block height",
+		})
+		return
+	}
+
+	proof, err := block.MerkleProof(c.Param("tx_hash"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	transaction, err := block.Transactions[proof.Index].MarshalBinary()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"block_height": block.Index,
+			"block_hash":   block.Hash,
+			"merkle_root":  block.MerkleRoot,
+			"proof":        proof,
+			"transaction":  hex.EncodeToString(transaction),
+		},
+	})
+}
+
 // getPendingTransactions returns pending transactions from the pool
 func (s *Server) getPendingTransactions(c *gin.Context) {
 	c.JSON(200, gin.H{
@@ -127,25 +188,78 @@ func (s *Server) checkChainValidity(c *gin.Context) {
 	})
 }
 
-// getBlockReward returns current block reward
+// getReorgs returns recent chain reorganizations
+func (s *Server) getReorgs(c *gin.Context) {
+	reorgs := s.blockchain.GetReorgs()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"reorgs":      reorgs,
+			"count":       len(reorgs),
+			"side_blocks": s.blockchain.GetSideBlockCount(),
+		},
+	})
+}
+
+// getBlockReward returns the block reward at a height, defaulting to the next block
 func (s *Server) getBlockReward(c *gin.Context) {
+	height := s.blockchain.GetLastBlock().Index + 1
+	if param := c.Query("height"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid block height",
+			})
+			return
+		}
+		height = parsed
+	}
+
 	c.JSON(200, gin.H{
 		"success": true,
 		"data": gin.H{
-			"block_reward": s.blockchain.BlockReward,
+			"height":       height,
+			"block_reward": s.blockchain.GetBlockReward(height),
+			"emission":     s.blockchain.Emission,
 		},
 	})
 }
 
-// getDiscoveredPeers returns discovered peers
+// getSupply returns the emitted and circulating coin supply
+func (s *Server) getSupply(c *gin.Context) {
+	supply, err := s.blockchain.GetSupply()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    supply,
+	})
+}
+
+// getDiscoveredPeers returns the addresses in the node's address book
 func (s *Server) getDiscoveredPeers(c *gin.Context) {
-	// This would return peers discovered through peer discovery
-	// For now, return empty list
+	addresses := s.node.GetKnownAddresses()
+	tried := 0
+	for _, address := range addresses {
+		if address.Tried {
+			tried++
+		}
+	}
+
 	c.JSON(200, gin.H{
 		"success": true,
 		"data": gin.H{
-			"discovered_peers": []string{},
-			"count": 0,
+			"discovered_peers": addresses,
+			"count":            len(addresses),
+			"new":              len(addresses) - tried,
+			"tried":            tried,
 		},
 	})
 }
@@ -164,6 +278,85 @@ func (s *Server) getNetworkStats(c *gin.Context) {
 	})
 }
 
+// getBannedPeers returns the active peer bans
+func (s *Server) getBannedPeers(c *gin.Context) {
+	bans := s.node.GetBannedPeers()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"bans":  bans,
+			"count": len(bans),
+		},
+	})
+}
+
+// banPeer bans a peer host and disconnects it
+func (s *Server) banPeer(c *gin.Context) {
+	var request struct {
+		Address  string `json:"address" binding:"required"`
+		Duration string `json:"duration"` // Go duration, e.g. "24h"; defaults to the configured ban duration
+		Reason   string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	duration := s.config.BanDuration
+	if request.Duration != "" {
+		parsed, err := time.ParseDuration(request.Duration)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid ban duration",
+			})
+			return
+		}
+		duration = parsed
+	}
+	if request.Reason == "" {
+		request.Reason = "banned via API"
+	}
+
+	if err := s.node.BanPeer(request.Address, duration, request.Reason); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"address":  request.Address,
+			"duration": duration.String(),
+		},
+	})
+}
+
+// unbanPeer lifts the ban of a peer host
+func (s *Server) unbanPeer(c *gin.Context) {
+	address := c.Param("address")
+	if err := s.node.UnbanPeer(address); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"address": address,
+		},
+	})
+}
+
 // getNodeConfig returns node configuration (without sensitive info)
 func (s *Server) getNodeConfig(c *gin.Context) {
 	c.JSON(200, gin.H{
@@ -172,11 +365,30 @@ func (s *Server) getNodeConfig(c *gin.Context) {
 			"node_id":      s.config.NodeID,
 			"version":      s.config.Version,
 			"environment":  s.config.Environment,
+			"target_outbound_peers":  s.config.TargetOutboundPeers,
+			"max_outbound_peers":     s.config.MaxOutboundPeers,
+			"max_inbound_peers":      s.config.MaxInboundPeers,
+			"p2p_encryption":         s.config.P2PEncryption,
+			"p2p_require_encryption": s.config.P2PRequireEncryption,
+			"ban_threshold":          s.config.BanThreshold,
+			"ban_duration":           s.config.BanDuration.String(),
+			"max_message_rate":       s.config.MaxMessageRate,
+			"max_message_burst":      s.config.MaxMessageBurst,
+			"max_peers_per_ip":       s.config.MaxPeersPerIP,
+			"max_peers_per_subnet":   s.config.MaxPeersPerSubnet,
 			"api_enabled":  s.config.APIEnabled,
 			"api_host":     s.config.APIHost,
 			"api_port":     s.config.APIPort,
-			"difficulty":   s.config.Difficulty,
+			"genesis_bits":   s.config.GenesisBits,
+			"pow_limit_bits": s.config.PowLimitBits,
+			"target_block_time": s.config.TargetBlockTime.String(),
+			"retarget_interval": s.config.RetargetInterval,
 			"block_reward": s.config.BlockReward,
+			"halving_interval": s.config.HalvingInterval,
+			"tail_emission":    s.config.TailEmission,
+			"max_supply":       s.config.MaxSupply,
+			"coin_symbol":   s.config.CoinSymbol,
+			"coin_decimals": s.config.CoinDecimals,
 		},
 	})
 }
@@ -192,24 +404,151 @@ func (s *Server) restartNode(c *gin.Context) {
 	})
 }
 
-// createWallet creates a new wallet (placeholder)
+// createWallet creates a new HD wallet, or restores one from a mnemonic
 func (s *Server) createWallet(c *gin.Context) {
-	c.JSON(200, gin.H{
+	var walletRequest struct {
+		Name       string `json:"name" binding:"required"`
+		Passphrase string `json:"passphrase" binding:"required"`
+		Mnemonic   string `json:"mnemonic"`
+	}
+
+	if err := c.ShouldBindJSON(&walletRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	mnemonic := walletRequest.Mnemonic
+	var err error
+	if mnemonic == "" {
+		mnemonic, err = s.keyManager.CreateHDWallet(walletRequest.Name, walletRequest.Passphrase)
+	} else {
+		err = s.keyManager.RestoreHDWallet(walletRequest.Name, mnemonic, walletRequest.Passphrase)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	keyPair, err := s.keyManager.DeriveAddress(walletRequest.Name, 0, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	data := gin.H{
+		"name":    walletRequest.Name,
+		"address": keyPair.Address,
+		"path":    crypto.AccountPath(0, 0),
+	}
+	// Only a newly generated mnemonic is returned, and only this once
+	if walletRequest.Mnemonic == "" {
+		data["mnemonic"] = mnemonic
+		data["note"] = "Write down the mnemonic, it is the only backup of this wallet"
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// unlockWallet unlocks an HD wallet for address derivation
+func (s *Server) unlockWallet(c *gin.Context) {
+	var unlockRequest struct {
+		Name       string `json:"name" binding:"required"`
+		Passphrase string `json:"passphrase" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&unlockRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := s.keyManager.UnlockHDWallet(unlockRequest.Name, unlockRequest.Passphrase); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, crypto.ErrInvalidPassphrase) {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data": gin.H{
-			"message": "Wallet creation endpoint",
-			"note":    "This would generate new cryptographic key pairs",
+			"name":    unlockRequest.Name,
+			"message": "Wallet unlocked",
 		},
 	})
 }
 
-// getAddresses returns wallet addresses (placeholder)
+// getAddresses derives addresses of an account in an unlocked HD wallet
 func (s *Server) getAddresses(c *gin.Context) {
-	c.JSON(200, gin.H{
+	name := c.Query("wallet")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "wallet parameter is required",
+		})
+		return
+	}
+
+	account, errAccount := strconv.ParseUint(c.DefaultQuery("account", "0"), 10, 31)
+	start, errStart := strconv.ParseUint(c.DefaultQuery("start", "0"), 10, 31)
+	count, errCount := strconv.Atoi(c.DefaultQuery("count", "10"))
+	if errAccount != nil || errStart != nil || errCount != nil || count < 1 || count > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid account, start or count",
+		})
+		return
+	}
+
+	addresses := make([]gin.H, 0, count)
+	for i := 0; i < count; i++ {
+		index := uint32(start) + uint32(i)
+		keyPair, err := s.keyManager.DeriveAddress(name, uint32(account), index)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, crypto.ErrKeyLocked) {
+				status = http.StatusForbidden
+			}
+			c.JSON(status, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		addresses = append(addresses, gin.H{
+			"index":   index,
+			"path":    crypto.AccountPath(uint32(account), index),
+			"address": keyPair.Address,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data": gin.H{
-			"addresses": []string{},
-			"note":     "This would return addresses from the wallet",
+			"wallet":    name,
+			"account":   account,
+			"addresses": addresses,
+			"count":     len(addresses),
 		},
 	})
-}
\ No newline at end of file
+}
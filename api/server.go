@@ -3,11 +3,12 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"path/filepath"
 	"strconv"
-	"time"
 
 	"aetherchain/blockchain"
 	"aetherchain/config"
+	"aetherchain/crypto"
 	"aetherchain/network"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +19,7 @@ type Server struct {
 	config    *config.Config
 	blockchain *blockchain.Blockchain
 	node      *network.Node
+	keyManager *crypto.KeyManager
 	router    *gin.Engine
 }
 
@@ -27,6 +29,7 @@ func NewServer(cfg *config.Config, bc *blockchain.Blockchain, node *network.Node
 		config:    cfg,
 		blockchain: bc,
 		node:      node,
+		keyManager: crypto.NewKeyManager(filepath.Join(cfg.DataDirectory, "keys")),
 		router:    gin.Default(),
 	}
 
@@ -56,22 +59,35 @@ func (s *Server) getDocumentation(c *gin.Context) {
 				"GET /api/v1/blockchain/info":           "Get blockchain information",
 				"GET /api/v1/blockchain/blocks":         "Get all blocks",
 				"GET /api/v1/blockchain/blocks/:height": "Get block by height",
+				"GET /api/v1/blockchain/blocks/:height/proof/:tx_hash": "Get Merkle inclusion proof of a transaction",
 				"GET /api/v1/blockchain/balance/:address": "Get address balance",
+				"GET /api/v1/blockchain/nonce/:address":   "Get next expected nonce of an address",
+				"GET /api/v1/blockchain/reorgs":           "Get recent chain reorganizations",
 				"POST /api/v1/blockchain/transactions":  "Create new transaction",
 			},
 			"mining": gin.H{
 				"GET /api/v1/mining/mine":   "Mine a new block",
 				"GET /api/v1/mining/status": "Get mining status",
+				"GET /api/v1/mining/reward?height=N": "Get the block reward at a height",
+				"GET /api/v1/mining/supply": "Get emitted and circulating supply",
 			},
 			"network": gin.H{
 				"GET /api/v1/network/info":  "Get network information",
 				"GET /api/v1/network/peers": "Get connected peers",
 				"POST /api/v1/network/peers": "Add new peer",
+				"GET /api/v1/network/peers/banned":        "Get banned peers",
+				"POST /api/v1/network/peers/ban":          "Ban a peer host",
+				"DELETE /api/v1/network/peers/ban/:address": "Unban a peer host",
 			},
 			"node": gin.H{
 				"GET /api/v1/node/status":  "Get node status",
 				"GET /api/v1/node/version": "Get node version",
 			},
+			"wallet": gin.H{
+				"POST /api/v1/wallet/create":    "Create or restore an HD wallet",
+				"POST /api/v1/wallet/unlock":    "Unlock an HD wallet",
+				"GET /api/v1/wallet/addresses":  "Derive wallet addresses",
+			},
 		},
 	}
 
@@ -102,7 +118,11 @@ func (s *Server) getBlocks(c *gin.Context) {
 func (s *Server) getBlockByHeight(c *gin.Context) {
 	heightStr := c.Param("height")
 	height, err := strconv.Atoi(heightStr)
-	if err != nil || height < 0 || height >= len(s.blockchain.Chain) {
+	if err != nil {
+		height = -1
+	}
+	block := s.blockchain.GetBlockByIndex(height)
+	if block == nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error":   "Invalid block height",
@@ -112,7 +132,7 @@ func (s *Server) getBlockByHeight(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data":    s.blockchain.Chain[height],
+		"data":    block,
 	})
 }
 
@@ -146,13 +166,17 @@ func (s *Server) getTransaction(c *gin.Context) {
 	})
 }
 
-// createTransaction creates a new transaction
+// createTransaction submits a signed transaction to the pool
 func (s *Server) createTransaction(c *gin.Context) {
 	var txRequest struct {
-		From   string  `json:"from" binding:"required"`
-		To     string  `json:"to" binding:"required"`
-		Amount float64 `json:"amount" binding:"required"`
-		Fee    float64 `json:"fee"`
+		From      string  `json:"from" binding:"required"`
+		To        string  `json:"to" binding:"required"`
+		Amount    blockchain.Amount `json:"amount" binding:"required"`
+		Fee       blockchain.Amount `json:"fee"`
+		Nonce     *int64  `json:"nonce" binding:"required"`
+		Timestamp int64   `json:"timestamp" binding:"required"`
+		PublicKey string  `json:"public_key" binding:"required"`
+		Signature string  `json:"signature" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&txRequest); err != nil {
@@ -163,14 +187,28 @@ func (s *Server) createTransaction(c *gin.Context) {
 		return
 	}
 
-	// Create transaction
-	tx := blockchain.NewTransaction(
-		txRequest.From,
-		txRequest.To,
-		txRequest.Amount,
-		txRequest.Fee,
-		time.Now().UnixNano(), // Using timestamp as nonce for simplicity
-	)
+	// Rebuild the transaction exactly as the client signed it
+	tx := &blockchain.Transaction{
+		Version:   1,
+		From:      txRequest.From,
+		To:        txRequest.To,
+		Amount:    txRequest.Amount,
+		Fee:       txRequest.Fee,
+		Nonce:     *txRequest.Nonce,
+		Timestamp: txRequest.Timestamp,
+		PublicKey: txRequest.PublicKey,
+		Signature: txRequest.Signature,
+		Status:    "pending",
+	}
+	tx.Hash = tx.CalculateHash()
+
+	if !tx.VerifySignature() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "invalid transaction signature",
+		})
+		return
+	}
 
 	// Add to blockchain
 	if err := s.blockchain.AddTransaction(tx); err != nil {
@@ -180,6 +218,7 @@ func (s *Server) createTransaction(c *gin.Context) {
 		})
 		return
 	}
+	s.node.RelayTransaction(tx)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
@@ -204,6 +243,20 @@ func (s *Server) getBalance(c *gin.Context) {
 	})
 }
 
+// getNonce returns the confirmed and next expected nonce of an address
+func (s *Server) getNonce(c *gin.Context) {
+	address := c.Param("address")
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"address":    address,
+			"nonce":      s.blockchain.GetNonce(address),
+			"next_nonce": s.blockchain.GetNextNonce(address),
+		},
+	})
+}
+
 // mineBlock mines a new block
 func (s *Server) mineBlock(c *gin.Context) {
 	minerAddress := c.DefaultQuery("miner", "default_miner")
@@ -216,6 +269,14 @@ func (s *Server) mineBlock(c *gin.Context) {
 		})
 		return
 	}
+	if err := s.blockchain.AddBlock(block); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	s.node.RelayBlock(block)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -232,8 +293,9 @@ func (s *Server) getMiningStatus(c *gin.Context) {
 		"success": true,
 		"data": gin.H{
 			"mining":       false, // This would track actual mining status
-			"difficulty":   s.blockchain.Difficulty,
-			"block_reward": s.blockchain.BlockReward,
+			"difficulty":   s.blockchain.GetNextDifficulty(),
+			"bits":         s.blockchain.GetNextBits(),
+			"block_reward": s.blockchain.GetBlockReward(s.blockchain.GetLastBlock().Index + 1),
 		},
 	})
 }
@@ -279,12 +341,14 @@ func (s *Server) addPeer(c *gin.Context) {
         return
     }
 
-    // استفاده از متد public یا ایجاد متد public
-    // اگر connectToNode unexported هست، این رو تغییر بده:
-    go func() {
-        // ایجاد یک متد public در network/node.go
-        s.node.ConnectToNode(peerRequest.Address)
-    }()
+    // The node connects shortly and keeps reconnecting if the connection drops
+    if err := s.node.AddPersistentPeer(peerRequest.Address); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "success": false,
+            "error":   err.Error(),
+        })
+        return
+    }
 
     c.JSON(http.StatusOK, gin.H{
         "success": true,
@@ -302,8 +366,8 @@ func (s *Server) getNodeStatus(c *gin.Context) {
 		"data": gin.H{
 			"status":      "running",
 			"uptime":      "0", // This would track actual uptime
-			"block_height": len(s.blockchain.Chain),
-			"sync_status": "synced",
+			"block_height": s.blockchain.GetLastBlock().Index,
+			"sync_status": s.node.GetSyncStatus(),
 		},
 	})
 }
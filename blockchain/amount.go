@@ -0,0 +1,215 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Amount is a quantity of coins in indivisible base units
+type Amount uint64
+
+var (
+	// ErrAmountOverflow is returned when arithmetic exceeds the Amount range
+	ErrAmountOverflow = errors.New("amount overflow")
+	// ErrAmountUnderflow is returned when a subtraction would go below zero
+	ErrAmountUnderflow = errors.New("amount underflow")
+)
+
+// Denomination describes how base units are displayed as coins
+type Denomination struct {
+	Symbol   string // Ticker symbol, e.g. "AETH"
+	Decimals int    // Number of base-unit digits after the decimal point
+}
+
+// DefaultDenomination is used unless SetDenomination is called at startup
+var DefaultDenomination = Denomination{Symbol: "AETH", Decimals: 8}
+
+var denomination = DefaultDenomination
+
+// SetDenomination configures the coin denomination.
+// It must be called before any amounts are parsed or encoded.
+func SetDenomination(d Denomination) error {
+	if d.Decimals < 0 || d.Decimals > 18 {
+		return fmt.Errorf("invalid denomination decimals: %d", d.Decimals)
+	}
+	denomination = d
+	return nil
+}
+
+// GetDenomination returns the configured coin denomination
+func GetDenomination() Denomination {
+	return denomination
+}
+
+// unitsPerCoin returns the number of base units in one coin
+func unitsPerCoin() uint64 {
+	units := uint64(1)
+	for i := 0; i < denomination.Decimals; i++ {
+		units *= 10
+	}
+	return units
+}
+
+// Coins returns the Amount of n whole coins
+func Coins(n uint64) Amount {
+	amount, err := Amount(n).Mul(unitsPerCoin())
+	if err != nil {
+		return Amount(math.MaxUint64)
+	}
+	return amount
+}
+
+// Add returns a + b, failing on overflow
+func (a Amount) Add(b Amount) (Amount, error) {
+	sum := a + b
+	if sum < a {
+		return 0, ErrAmountOverflow
+	}
+	return sum, nil
+}
+
+// Sub returns a - b, failing if b is larger than a
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if b > a {
+		return 0, ErrAmountUnderflow
+	}
+	return a - b, nil
+}
+
+// Mul returns a * n, failing on overflow
+func (a Amount) Mul(n uint64) (Amount, error) {
+	if a == 0 || n == 0 {
+		return 0, nil
+	}
+	product := a * Amount(n)
+	if uint64(product)/n != uint64(a) {
+		return 0, ErrAmountOverflow
+	}
+	return product, nil
+}
+
+// String formats the amount as a decimal number of coins
+func (a Amount) String() string {
+	units := unitsPerCoin()
+	whole := uint64(a) / units
+	if denomination.Decimals == 0 {
+		return strconv.FormatUint(whole, 10)
+	}
+
+	fraction := strconv.FormatUint(uint64(a)%units, 10)
+	fraction = strings.Repeat("0", denomination.Decimals-len(fraction)) + fraction
+	return strconv.FormatUint(whole, 10) + "." + fraction
+}
+
+// ParseAmount parses a decimal number of coins such as "12.5".
+// More fractional digits than the denomination allows are rejected.
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	wholePart, fractionPart, hasFraction := strings.Cut(s, ".")
+	if wholePart == "" || (hasFraction && fractionPart == "") {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(fractionPart) > denomination.Decimals {
+		return 0, fmt.Errorf("amount %q has more than %d decimal places", s, denomination.Decimals)
+	}
+
+	whole, err := strconv.ParseUint(wholePart, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	var fraction uint64
+	if fractionPart != "" {
+		padded := fractionPart + strings.Repeat("0", denomination.Decimals-len(fractionPart))
+		fraction, err = strconv.ParseUint(padded, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+
+	amount, err := Amount(whole).Mul(unitsPerCoin())
+	if err != nil {
+		return 0, fmt.Errorf("amount %q out of range", s)
+	}
+	amount, err = amount.Add(Amount(fraction))
+	if err != nil {
+		return 0, fmt.Errorf("amount %q out of range", s)
+	}
+	return amount, nil
+}
+
+// MustParseAmount is like ParseAmount but panics on invalid input.
+// It is intended for constants.
+func MustParseAmount(s string) Amount {
+	amount, err := ParseAmount(s)
+	if err != nil {
+		panic(err)
+	}
+	return amount
+}
+
+// AmountFromFloat converts a float coin value from legacy data or configuration,
+// rounding to the nearest base unit
+func AmountFromFloat(f float64) (Amount, error) {
+	if f < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid amount %v", f)
+	}
+	return parseLegacyNumber(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// parseLegacyNumber parses a JSON number written by versions that stored
+// float64 balances. Digits beyond the denomination are rounded half-up
+// rather than rejected so that drifted balances can still be migrated.
+func parseLegacyNumber(s string) (Amount, error) {
+	value, ok := new(big.Rat).SetString(s)
+	if !ok || value.Sign() < 0 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	scaled := value.Mul(value, new(big.Rat).SetInt(new(big.Int).SetUint64(unitsPerCoin())))
+	rounded := new(big.Int).Quo(new(big.Int).Add(new(big.Int).Mul(scaled.Num(), big.NewInt(2)), scaled.Denom()),
+		new(big.Int).Mul(scaled.Denom(), big.NewInt(2)))
+	if !rounded.IsUint64() {
+		return 0, fmt.Errorf("amount %q out of range", s)
+	}
+	return Amount(rounded.Uint64()), nil
+}
+
+// MarshalJSON encodes the amount as a decimal string of coins
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON decodes a decimal string of coins. Plain JSON numbers from
+// data written before integer amounts are accepted for migration.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		amount, err := ParseAmount(text)
+		if err != nil {
+			return err
+		}
+		*a = amount
+		return nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("invalid amount %s", string(data))
+	}
+	amount, err := parseLegacyNumber(number.String())
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
@@ -3,40 +3,50 @@ package blockchain
 import (
     "crypto/sha256"
     "encoding/hex"
-    "encoding/json"
+    "fmt"
     "time"
 )
 
-// Block represents a single block in the AetherChain blockchain
-type Block struct {
-    // Header
+// BlockHeader holds every consensus-relevant field of a block.
+// The block hash is the hash of the header, so none of these fields can be
+// changed without invalidating the proof of work.
+type BlockHeader struct {
     Version    int    `json:"version"`     // Block version for protocol upgrades
     Index      int    `json:"index"`       // Block height in the chain
     Timestamp  int64  `json:"timestamp"`   // Unix timestamp of block creation
     PrevHash   string `json:"prev_hash"`   // Hash of the previous block
     MerkleRoot string `json:"merkle_root"` // Merkle root of transactions
+    Nonce      int64  `json:"nonce"`       // Proof-of-Work nonce
+    ExtraNonce uint64 `json:"extra_nonce"` // Rolled by miners once the nonce space is exhausted
+    Bits       uint32 `json:"bits"`        // Compact proof-of-work target
+    
+    // Coinbase
+    Miner       string `json:"miner"`        // Miner's address
+    BlockReward Amount `json:"block_reward"` // Subsidy the coinbase may claim on top of fees
+}
+
+// Block represents a single block in the AetherChain blockchain
+type Block struct {
+    BlockHeader
     
     // Body
     Transactions []*Transaction `json:"transactions"` // List of transactions
-    Nonce        int64          `json:"nonce"`        // Proof-of-Work nonce
-    Difficulty   int            `json:"difficulty"`   // Mining difficulty
     
     // Metadata
-    Hash         string  `json:"hash"`          // Current block hash
-    Miner        string  `json:"miner"`         // Miner's address
-    BlockReward  float64 `json:"block_reward"`  // Reward for mining this block
+    Hash string `json:"hash"` // Current block hash, equal to the header hash
 }
 
 // NewBlock creates a new block with the given parameters
-func NewBlock(index int, transactions []*Transaction, prevHash string, difficulty int) *Block {
+func NewBlock(index int, transactions []*Transaction, prevHash string, bits uint32) *Block {
     block := &Block{
-        Version:      1,
-        Index:        index,
-        Timestamp:    time.Now().Unix(),
-        PrevHash:     prevHash,
+        BlockHeader: BlockHeader{
+            Version:     1,
+            Index:       index,
+            Timestamp:   time.Now().Unix(),
+            PrevHash:    prevHash,
+            Bits:        bits,
+        },
         Transactions: transactions,
-        Difficulty:   difficulty,
-        BlockReward:  50.0, // Base block reward
     }
     
     // Calculate Merkle root from transactions
@@ -45,71 +55,107 @@ func NewBlock(index int, transactions []*Transaction, prevHash string, difficult
     return block
 }
 
-// CalculateHash computes and returns the SHA-256 hash of the block
-func (b *Block) CalculateHash() string {
-    // Create a struct for hashing that excludes the current hash
-    hashData := struct {
-        Version    int      `json:"version"`
-        Index      int      `json:"index"`
-        Timestamp  int64    `json:"timestamp"`
-        PrevHash   string   `json:"prev_hash"`
-        MerkleRoot string   `json:"merkle_root"`
-        Nonce      int64    `json:"nonce"`
-        Difficulty int      `json:"difficulty"`
-    }{
-        Version:    b.Version,
-        Index:      b.Index,
-        Timestamp:  b.Timestamp,
-        PrevHash:   b.PrevHash,
-        MerkleRoot: b.MerkleRoot,
-        Nonce:      b.Nonce,
-        Difficulty: b.Difficulty,
-    }
-    
-    data, _ := json.Marshal(hashData)
-    hash := sha256.Sum256(data)
+// CalculateHash computes and returns the SHA-256 hash of the header
+func (h *BlockHeader) CalculateHash() string {
+    hash := sha256.Sum256(h.headerBytes())
     return hex.EncodeToString(hash[:])
 }
 
-// CalculateMerkleRoot computes the Merkle root of all transactions
+// CalculateMerkleRoot computes the Merkle root of the witness hashes of all
+// transactions, committing to their signatures and public keys
 func (b *Block) CalculateMerkleRoot() string {
-    if len(b.Transactions) == 0 {
-        return ""
+    return MerkleRoot(b.witnessHashes())
+}
+
+// MerkleProof returns the inclusion proof of a transaction in this block,
+// looked up by its transaction hash or its witness hash
+func (b *Block) MerkleProof(txHash string) (*MerkleProof, error) {
+    witnessHashes := b.witnessHashes()
+    for i, tx := range b.Transactions {
+        if tx.Hash == txHash || witnessHashes[i] == txHash {
+            proof, err := BuildMerkleProof(witnessHashes, i)
+            if err != nil {
+                return nil, err
+            }
+            proof.TxHash = tx.Hash
+            return proof, nil
+        }
     }
-    
-    // Simple implementation - in production, use proper Merkle tree
-    var txHashes string
-    for _, tx := range b.Transactions {
-        txHashes += tx.Hash
+    return nil, fmt.Errorf("transaction %s not found in block %d", txHash, b.Index)
+}
+
+// Coinbase returns the block's coinbase transaction, or nil if it has none
+func (b *Block) Coinbase() *Transaction {
+    if len(b.Transactions) == 0 || !b.Transactions[0].IsCoinbase() {
+        return nil
     }
-    
-    hash := sha256.Sum256([]byte(txHashes))
-    return hex.EncodeToString(hash[:])
+    return b.Transactions[0]
 }
 
-// IsValid checks if the block's hash meets the difficulty requirement
-func (b *Block) IsValid() bool {
-    // Verify hash meets difficulty target
-    hash := b.CalculateHash()
-    prefix := ""
-    for i := 0; i < b.Difficulty; i++ {
-        prefix += "0"
+// TotalFees returns the sum of the fees paid by the block's non-coinbase transactions
+func (b *Block) TotalFees() (Amount, error) {
+    return totalFees(b.Transactions)
+}
+
+// totalFees sums the fees of the given transactions, skipping coinbases
+func totalFees(transactions []*Transaction) (Amount, error) {
+    var total Amount
+    for _, tx := range transactions {
+        if tx.IsCoinbase() {
+            continue
+        }
+        sum, err := total.Add(tx.Fee)
+        if err != nil {
+            return 0, err
+        }
+        total = sum
+    }
+    return total, nil
+}
+
+// witnessHashes returns the witness hashes of the block's transactions in order
+func (b *Block) witnessHashes() []string {
+    hashes := make([]string, len(b.Transactions))
+    for i, tx := range b.Transactions {
+        hashes[i] = tx.WitnessHash()
     }
+    return hashes
+}
+
+// IsValid checks if the header's hash meets its own target
+func (h *BlockHeader) IsValid() bool {
+    target := h.Target()
+    hash, ok := HashToBig(h.CalculateHash())
     
-    return len(hash) >= b.Difficulty && hash[:b.Difficulty] == prefix
+    return ok && target.Sign() > 0 && hash.Cmp(target) <= 0
 }
 
-// Serialize converts the block to JSON bytes
+// Serialize converts the block to its canonical binary encoding
 func (b *Block) Serialize() ([]byte, error) {
-    return json.Marshal(b)
+    return b.MarshalBinary()
 }
 
-// DeserializeBlock creates a Block from JSON bytes
+// Serialize converts the header to its canonical binary encoding
+func (h *BlockHeader) Serialize() ([]byte, error) {
+    return h.MarshalBinary()
+}
+
+// DeserializeBlockHeader creates a BlockHeader from its canonical binary encoding
+func DeserializeBlockHeader(data []byte) (*BlockHeader, error) {
+    var header BlockHeader
+    err := header.UnmarshalBinary(data)
+    if err != nil {
+        return nil, err
+    }
+    return &header, nil
+}
+
+// DeserializeBlock creates a Block from its canonical binary encoding
 func DeserializeBlock(data []byte) (*Block, error) {
     var block Block
-    err := json.Unmarshal(data, &block)
+    err := block.UnmarshalBinary(data)
     if err != nil {
         return nil, err
     }
     return &block, nil
-}
\ No newline at end of file
+}
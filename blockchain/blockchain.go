@@ -10,23 +10,37 @@ import (
 type Blockchain struct {
     Chain        []*Block          `json:"chain"`
     PendingTx    []*Transaction    `json:"pending_transactions"`
-    Difficulty   int               `json:"difficulty"`
-    BlockReward  float64           `json:"block_reward"`
+    GenesisBits  uint32            `json:"genesis_bits"` // Genesis target, later blocks follow Retarget
+    Emission     EmissionSchedule  `json:"emission"`
+    Retarget     RetargetPolicy    `json:"retarget"`
     
     // State management
-    Accounts     map[string]float64 `json:"accounts"` // Address -> Balance
+    Accounts     map[string]Amount  `json:"accounts"` // Address -> Balance
+    Nonces       map[string]int64   `json:"nonces"`   // Address -> Number of confirmed transactions sent
     TransactionPool []*Transaction  `json:"transaction_pool"`
     
+    // Fork choice
+    blocks  map[string]*blockNode // Block tree of the main chain and side branches, by hash
+    txIndex map[string]string     // Transaction hash -> hash of the last indexed block containing it
+    reorgs  []ReorgEvent
+    orphans *orphanPool // Blocks whose parent has not arrived yet
+    
+    // Called with the new tip whenever the main chain tip changes
+    tipListeners []func(tip *Block)
+    
     // Concurrency control
     mutex sync.RWMutex
 }
 
 // NewBlockchain creates and initializes a new blockchain
-func NewBlockchain(difficulty int, blockReward float64) *Blockchain {
+func NewBlockchain(genesisBits uint32, emission EmissionSchedule, retarget RetargetPolicy) *Blockchain {
     bc := &Blockchain{
-        Difficulty:  difficulty,
-        BlockReward: blockReward,
-        Accounts:    make(map[string]float64),
+        GenesisBits: genesisBits,
+        Emission:    emission,
+        Retarget:    retarget,
+        Accounts:    make(map[string]Amount),
+        Nonces:      make(map[string]int64),
+        orphans:     newOrphanPool(),
     }
     
     // Create and add the genesis block
@@ -43,46 +57,100 @@ func (bc *Blockchain) CreateGenesisBlock() {
     genesisTransactions := []*Transaction{
         {
             Version:   1,
-            Hash:      "genesis_transaction",
             From:      "0",
             To:        "genesis_address",
-            Amount:    1000000,
+            Amount:    Coins(1000000),
             Fee:       0,
             Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Unix(),
             Status:    "confirmed",
         },
     }
     
-    genesisBlock := NewBlock(0, genesisTransactions, "0", bc.Difficulty)
-    genesisBlock.Hash = genesisBlock.CalculateHash()
+    for _, tx := range genesisTransactions {
+        tx.Hash = tx.CalculateHash()
+    }
+    
+    // The genesis block is fixed, so that every node of a network derives
+    // the same genesis hash
+    genesisBlock := NewBlock(0, genesisTransactions, "0", bc.GenesisBits)
+    genesisBlock.Timestamp = genesisTransactions[0].Timestamp
     genesisBlock.Miner = "genesis_miner"
+    genesisBlock.Hash = genesisBlock.CalculateHash()
     
     bc.Chain = []*Block{genesisBlock}
     
     // Initialize genesis account
-    bc.Accounts["genesis_address"] = 1000000
+    bc.Accounts["genesis_address"] = Coins(1000000)
 }
 
-// AddBlock adds a new block to the blockchain after validation
+// AddBlock adds a new block to the blockchain after validation.
+// Blocks that do not extend the tip are kept as side branches, and the chain
+// reorganizes when a side branch accumulates more work than the main chain.
+// Blocks whose parent is unknown are held in the orphan pool and
+// ErrOrphanBlock is returned; they are connected once the parent is added.
 func (bc *Blockchain) AddBlock(block *Block) error {
+    if block == nil {
+        return fmt.Errorf("invalid block")
+    }
+    
+    bc.mutex.Lock()
+    bc.syncIndex()
+    oldTip := bc.Chain[len(bc.Chain)-1]
+    err := bc.addBlock(block)
+    if err == nil {
+        bc.connectOrphans(block.Hash)
+    }
+    newTip := bc.Chain[len(bc.Chain)-1]
+    listeners := bc.tipListeners
+    bc.mutex.Unlock()
+    
+    // A failed reorganization may still have moved the tip before restoring it,
+    // so compare the tips rather than relying on err
+    if newTip != oldTip {
+        for _, listener := range listeners {
+            listener(newTip)
+        }
+    }
+    return err
+}
+
+// OnTipChanged registers a function called with the new tip whenever a
+// block or a reorganization changes the main chain tip. Listeners run after
+// the chain lock is released, in the goroutine that added the block.
+func (bc *Blockchain) OnTipChanged(listener func(tip *Block)) {
     bc.mutex.Lock()
     defer bc.mutex.Unlock()
     
+    bc.tipListeners = append(bc.tipListeners, listener)
+}
+
+// addBlock adds a block to the main chain or a side branch, or holds it as an orphan
+func (bc *Blockchain) addBlock(block *Block) error {
+    if _, known := bc.blocks[block.Hash]; known {
+        return fmt.Errorf("%w: %s", ErrKnownBlock, block.Hash)
+    }
+    
+    lastBlock := bc.Chain[len(bc.Chain)-1]
+    if block.PrevHash != lastBlock.Hash {
+        if _, known := bc.blocks[block.PrevHash]; !known {
+            return bc.addOrphan(block)
+        }
+        return bc.addSideBlock(block)
+    }
+    
     // Validate the block
     if !bc.IsValidBlock(block) {
         return fmt.Errorf("invalid block")
     }
     
-    // Process transactions in the block
-    for _, tx := range block.Transactions {
-        bc.processTransaction(tx)
+    // Apply transactions and miner reward
+    if err := bc.applyBlock(block); err != nil {
+        return fmt.Errorf("failed to apply block %d: %v", block.Index, err)
     }
     
-    // Add miner reward
-    bc.Accounts[block.Miner] += block.BlockReward
-    
     // Add block to chain
     bc.Chain = append(bc.Chain, block)
+    bc.indexBlock(block, bc.blocks[lastBlock.Hash])
     
     // Remove processed transactions from pool
     bc.removeProcessedTransactions(block.Transactions)
@@ -90,8 +158,29 @@ func (bc *Blockchain) AddBlock(block *Block) error {
     return nil
 }
 
-// CreateNewBlock creates a new block with pending transactions
+// CreateNewBlock creates and mines a new block with pending transactions
 func (bc *Blockchain) CreateNewBlock(miner string) (*Block, error) {
+    newBlock, err := bc.NewBlockTemplate(miner)
+    if err != nil {
+        return nil, err
+    }
+    
+    // Mine the block
+    pow := NewProofOfWork(newBlock, newBlock.Bits)
+    nonce, hash, err := pow.Mine()
+    if err != nil {
+        return nil, err
+    }
+    
+    newBlock.Nonce = nonce
+    newBlock.Hash = hash
+    
+    return newBlock, nil
+}
+
+// NewBlockTemplate builds the next block on the current tip from pending
+// transactions, ready to be mined
+func (bc *Blockchain) NewBlockTemplate(miner string) (*Block, error) {
     bc.mutex.RLock()
     defer bc.mutex.RUnlock()
     
@@ -104,18 +193,32 @@ func (bc *Blockchain) CreateNewBlock(miner string) (*Block, error) {
     // Get transactions from pool (limit block size)
     transactions := bc.getTransactionsForBlock()
     
-    newBlock := NewBlock(len(bc.Chain), transactions, lastBlock.Hash, bc.Difficulty)
-    newBlock.Miner = miner
+    // The coinbase pays the subsidy plus all collected fees to the miner
+    fees, err := totalFees(transactions)
+    if err != nil {
+        return nil, err
+    }
+    subsidy := bc.Emission.Subsidy(len(bc.Chain))
+    value, err := subsidy.Add(fees)
+    if err != nil {
+        return nil, err
+    }
+    coinbase := NewCoinbaseTransaction(miner, len(bc.Chain), value)
+    transactions = append([]*Transaction{coinbase}, transactions...)
     
-    // Mine the block
-    pow := NewProofOfWork(newBlock, bc.Difficulty)
-    nonce, hash, err := pow.Mine()
+    bits, err := bc.expectedBits(len(bc.Chain))
     if err != nil {
         return nil, err
     }
     
-    newBlock.Nonce = nonce
-    newBlock.Hash = hash
+    newBlock := NewBlock(len(bc.Chain), transactions, lastBlock.Hash, bits)
+    newBlock.Miner = miner
+    newBlock.BlockReward = subsidy
+    
+    // Never fall behind the median time of recent blocks
+    if mtp := bc.medianTimePast(len(bc.Chain)); newBlock.Timestamp < mtp {
+        newBlock.Timestamp = mtp
+    }
     
     return newBlock, nil
 }
@@ -125,12 +228,42 @@ func (bc *Blockchain) AddTransaction(tx *Transaction) error {
     bc.mutex.Lock()
     defer bc.mutex.Unlock()
     
+    return bc.addTransaction(tx)
+}
+
+// addTransaction checks a transaction against the chain state and the pool
+// and adds it to the pool
+func (bc *Blockchain) addTransaction(tx *Transaction) error {
     if !tx.IsValid() {
         return fmt.Errorf("invalid transaction")
     }
     
-    // Check if sender has sufficient balance
-    if bc.Accounts[tx.From] < tx.Amount+tx.Fee {
+    // Reject duplicates already waiting in the pool
+    for _, pending := range bc.TransactionPool {
+        if pending.Hash == tx.Hash {
+            return fmt.Errorf("transaction already in pool")
+        }
+    }
+    
+    // Nonces must be used exactly once and in order
+    if tx.Nonce < bc.Nonces[tx.From] {
+        return fmt.Errorf("nonce %d already used, account nonce is %d", tx.Nonce, bc.Nonces[tx.From])
+    }
+    if expected := bc.nextNonce(tx.From); tx.Nonce != expected {
+        return fmt.Errorf("out-of-order nonce %d, expected %d", tx.Nonce, expected)
+    }
+    
+    // Check if sender has sufficient balance left after its pooled spends
+    total, err := tx.Amount.Add(tx.Fee)
+    if err != nil {
+        return err
+    }
+    pending, err := bc.pendingOutflow(tx.From)
+    if err != nil {
+        return err
+    }
+    available, err := bc.Accounts[tx.From].Sub(pending)
+    if err != nil || available < total {
         return fmt.Errorf("insufficient balance")
     }
     
@@ -138,47 +271,300 @@ func (bc *Blockchain) AddTransaction(tx *Transaction) error {
     return nil
 }
 
-// IsValidBlock validates a block before adding to the chain
+// IsValidBlock validates a block before adding to the chain.
+// The header is checked first so that invalid blocks are rejected
+// before any transaction is inspected.
 func (bc *Blockchain) IsValidBlock(block *Block) bool {
     if block == nil {
         return false
     }
     
-    // Check block index
-    if block.Index != len(bc.Chain) {
+    if block.Hash != block.CalculateHash() {
+        return false
+    }
+    
+    if err := bc.validateHeader(&block.BlockHeader); err != nil {
         return false
     }
     
+    return bc.validateBody(block) == nil
+}
+
+// ValidateHeader checks a header against the current chain tip without its body
+func (bc *Blockchain) ValidateHeader(header *BlockHeader) error {
+    bc.mutex.RLock()
+    defer bc.mutex.RUnlock()
+    
+    return bc.validateHeader(header)
+}
+
+// validateHeader checks the consensus rules that only depend on the header
+func (bc *Blockchain) validateHeader(header *BlockHeader) error {
+    if header == nil {
+        return fmt.Errorf("missing header")
+    }
+    
+    if header.Version < 1 {
+        return fmt.Errorf("unsupported block version %d", header.Version)
+    }
+    
+    // Check block index
+    if header.Index != len(bc.Chain) {
+        return fmt.Errorf("unexpected height %d, expected %d", header.Index, len(bc.Chain))
+    }
+    
     // Check previous hash
     lastBlock := bc.Chain[len(bc.Chain)-1]
-    if block.PrevHash != lastBlock.Hash {
-        return false
+    if header.PrevHash != lastBlock.Hash {
+        return fmt.Errorf("previous hash %s does not match tip %s", header.PrevHash, lastBlock.Hash)
     }
     
-    // Validate proof of work
-    pow := NewProofOfWork(block, bc.Difficulty)
-    if !pow.Validate() {
-        return false
+    if header.Timestamp > time.Now().Add(2*time.Hour).Unix() {
+        return fmt.Errorf("timestamp %d is too far in the future", header.Timestamp)
+    }
+    if mtp := bc.medianTimePast(header.Index); header.Timestamp < mtp {
+        return fmt.Errorf("timestamp %d is before median time past %d", header.Timestamp, mtp)
+    }
+    
+    if header.Miner == "" {
+        return fmt.Errorf("missing miner address")
+    }
+    // The subsidy is fixed by the emission schedule at this height
+    if subsidy := bc.Emission.Subsidy(header.Index); header.BlockReward != subsidy {
+        return fmt.Errorf("block reward %s, expected %s", header.BlockReward, subsidy)
     }
     
+    // Validate proof of work against the target required at this height
+    expected, err := bc.expectedBits(header.Index)
+    if err != nil {
+        return err
+    }
+    if header.Bits != expected {
+        return fmt.Errorf("target bits %#08x, expected %#08x", header.Bits, expected)
+    }
+    if !header.IsValid() {
+        return fmt.Errorf("insufficient proof of work")
+    }
+    
+    return nil
+}
+
+// validateBody checks a block's transactions against its already validated header
+func (bc *Blockchain) validateBody(block *Block) error {
+    // The header must commit to exactly these transactions
+    if block.MerkleRoot != block.CalculateMerkleRoot() {
+        return fmt.Errorf("merkle root does not match transactions")
+    }
+    
+    // The first transaction must be the coinbase and no other may mint coins
+    if err := bc.validateCoinbase(block); err != nil {
+        return err
+    }
+    transactions := block.Transactions[1:]
+    
     // Validate all transactions in the block
-    for _, tx := range block.Transactions {
+    for _, tx := range transactions {
+        if tx.IsCoinbase() {
+            return fmt.Errorf("unexpected coinbase transaction %s", tx.Hash)
+        }
         if !tx.IsValid() {
-            return false
+            return fmt.Errorf("invalid transaction %s", tx.Hash)
         }
     }
     
-    return true
+    // Each sender's nonces must continue from its account nonce without gaps,
+    // and every sender must afford its transactions in block order
+    nonces := make(map[string]int64)
+    balances := make(map[string]Amount)
+    balanceOf := func(address string) Amount {
+        if balance, seen := balances[address]; seen {
+            return balance
+        }
+        return bc.Accounts[address]
+    }
+    for _, tx := range transactions {
+        expected, seen := nonces[tx.From]
+        if !seen {
+            expected = bc.Nonces[tx.From]
+        }
+        if tx.Nonce != expected {
+            return fmt.Errorf("transaction %s: nonce %d, expected %d", tx.Hash, tx.Nonce, expected)
+        }
+        nonces[tx.From] = expected + 1
+        
+        total, err := tx.Amount.Add(tx.Fee)
+        if err != nil {
+            return fmt.Errorf("transaction %s: %v", tx.Hash, err)
+        }
+        senderBalance, err := balanceOf(tx.From).Sub(total)
+        if err != nil {
+            return fmt.Errorf("transaction %s: insufficient balance: %v", tx.Hash, err)
+        }
+        balances[tx.From] = senderBalance
+        recipientBalance, err := balanceOf(tx.To).Add(tx.Amount)
+        if err != nil {
+            return fmt.Errorf("transaction %s: %v", tx.Hash, err)
+        }
+        balances[tx.To] = recipientBalance
+    }
+    
+    return nil
+}
+
+// validateCoinbase checks that the block starts with a coinbase paying the
+// miner no more than the subsidy plus the fees of the block's transactions
+func (bc *Blockchain) validateCoinbase(block *Block) error {
+    coinbase := block.Coinbase()
+    if coinbase == nil {
+        return fmt.Errorf("first transaction is not a coinbase")
+    }
+    
+    if coinbase.Hash != coinbase.CalculateHash() {
+        return fmt.Errorf("coinbase hash does not match its contents")
+    }
+    if coinbase.To != block.Miner {
+        return fmt.Errorf("coinbase pays %s instead of miner %s", coinbase.To, block.Miner)
+    }
+    if coinbase.Nonce != int64(block.Index) {
+        return fmt.Errorf("coinbase nonce %d does not match height %d", coinbase.Nonce, block.Index)
+    }
+    if coinbase.Fee != 0 {
+        return fmt.Errorf("coinbase cannot pay a fee")
+    }
+    
+    fees, err := block.TotalFees()
+    if err != nil {
+        return err
+    }
+    limit, err := block.BlockReward.Add(fees)
+    if err != nil {
+        return err
+    }
+    if coinbase.Amount > limit {
+        return fmt.Errorf("coinbase value %s exceeds subsidy plus fees %s", coinbase.Amount, limit)
+    }
+    
+    return nil
 }
 
 // GetBalance returns the balance of an address
-func (bc *Blockchain) GetBalance(address string) float64 {
+func (bc *Blockchain) GetBalance(address string) Amount {
     bc.mutex.RLock()
     defer bc.mutex.RUnlock()
     
     return bc.Accounts[address]
 }
 
+// GetNonce returns the number of confirmed transactions sent by an address
+func (bc *Blockchain) GetNonce(address string) int64 {
+    bc.mutex.RLock()
+    defer bc.mutex.RUnlock()
+    
+    return bc.Nonces[address]
+}
+
+// GetNextNonce returns the nonce the next transaction from an address must use,
+// counting transactions still waiting in the pool
+func (bc *Blockchain) GetNextNonce(address string) int64 {
+    bc.mutex.RLock()
+    defer bc.mutex.RUnlock()
+    
+    return bc.nextNonce(address)
+}
+
+// GetBlockReward returns the subsidy of the block at the given height
+func (bc *Blockchain) GetBlockReward(height int) Amount {
+    return bc.Emission.Subsidy(height)
+}
+
+// GetSupply reports the coin supply at the current height: the genesis
+// allocation, the subsidies emitted by mined blocks, and the coins actually
+// held by accounts, which is lower when miners claim less than allowed
+func (bc *Blockchain) GetSupply() (map[string]interface{}, error) {
+    bc.mutex.RLock()
+    defer bc.mutex.RUnlock()
+    
+    var genesis Amount
+    for _, tx := range bc.Chain[0].Transactions {
+        sum, err := genesis.Add(tx.Amount)
+        if err != nil {
+            return nil, err
+        }
+        genesis = sum
+    }
+    
+    var circulating Amount
+    for _, balance := range bc.Accounts {
+        sum, err := circulating.Add(balance)
+        if err != nil {
+            return nil, err
+        }
+        circulating = sum
+    }
+    
+    height := len(bc.Chain) - 1
+    emitted := bc.Emission.Emitted(height)
+    total, err := genesis.Add(emitted)
+    if err != nil {
+        return nil, err
+    }
+    
+    return map[string]interface{}{
+        "height":         height,
+        "genesis_supply": genesis,
+        "emitted":        emitted,
+        "total_emitted":  total,
+        "circulating":    circulating,
+        "max_supply":     bc.Emission.MaxSupply,
+        "next_reward":    bc.Emission.Subsidy(height + 1),
+    }, nil
+}
+
+// GetBlock returns a known block by hash, on the main chain or a side branch
+func (bc *Blockchain) GetBlock(hash string) *Block {
+    bc.mutex.Lock()
+    defer bc.mutex.Unlock()
+    
+    bc.syncIndex()
+    if node, known := bc.blocks[hash]; known {
+        return node.block
+    }
+    return nil
+}
+
+// GetPendingTransactionCount returns the number of transactions in the pool
+func (bc *Blockchain) GetPendingTransactionCount() int {
+    bc.mutex.RLock()
+    defer bc.mutex.RUnlock()
+    
+    return len(bc.TransactionPool)
+}
+
+// GetBlockByIndex returns the main chain block at a height, or nil if the
+// chain is not that long
+func (bc *Blockchain) GetBlockByIndex(index int) *Block {
+    bc.mutex.RLock()
+    defer bc.mutex.RUnlock()
+    
+    if index < 0 || index >= len(bc.Chain) {
+        return nil
+    }
+    return bc.Chain[index]
+}
+
+// GetPendingTransaction returns a transaction waiting in the pool by hash
+func (bc *Blockchain) GetPendingTransaction(hash string) *Transaction {
+    bc.mutex.RLock()
+    defer bc.mutex.RUnlock()
+
+    for _, tx := range bc.TransactionPool {
+        if tx.Hash == hash {
+            return tx
+        }
+    }
+    return nil
+}
+
 // GetLastBlock returns the most recent block in the chain
 func (bc *Blockchain) GetLastBlock() *Block {
     bc.mutex.RLock()
@@ -210,8 +596,12 @@ func (bc *Blockchain) IsChainValid() bool {
             return false
         }
         
-        // Check proof of work
-        pow := NewProofOfWork(currentBlock, bc.Difficulty)
+        // Check proof of work against the target required at this height
+        expected, err := bc.expectedBits(i)
+        if err != nil || currentBlock.Bits != expected {
+            return false
+        }
+        pow := NewProofOfWork(currentBlock, expected)
         if !pow.Validate() {
             return false
         }
@@ -220,13 +610,118 @@ func (bc *Blockchain) IsChainValid() bool {
     return true
 }
 
+// RebuildState recomputes account balances and nonces by replaying the chain
+func (bc *Blockchain) RebuildState() error {
+    bc.mutex.Lock()
+    defer bc.mutex.Unlock()
+    
+    return bc.rebuildState()
+}
+
 // Helper functions
-func (bc *Blockchain) processTransaction(tx *Transaction) {
+func (bc *Blockchain) rebuildState() error {
+    bc.Accounts = make(map[string]Amount)
+    bc.Nonces = make(map[string]int64)
+    
+    for _, block := range bc.Chain {
+        if block.Index == 0 {
+            // Genesis transactions mint coins and have no sender
+            for _, tx := range block.Transactions {
+                balance, err := bc.Accounts[tx.To].Add(tx.Amount)
+                if err != nil {
+                    return fmt.Errorf("genesis block: %v", err)
+                }
+                bc.Accounts[tx.To] = balance
+            }
+            continue
+        }
+        
+        if err := bc.applyBlock(block); err != nil {
+            return fmt.Errorf("block %d: %v", block.Index, err)
+        }
+    }
+    
+    return nil
+}
+
+// applyBlock applies a block's transactions to account state.
+// The coinbase is credited last so its coins cannot be spent in the same block.
+func (bc *Blockchain) applyBlock(block *Block) error {
+    coinbase := block.Coinbase()
+    if coinbase == nil {
+        return fmt.Errorf("missing coinbase transaction")
+    }
+    
+    for _, tx := range block.Transactions[1:] {
+        if err := bc.processTransaction(tx); err != nil {
+            return fmt.Errorf("transaction %s: %v", tx.Hash, err)
+        }
+    }
+    
+    // Pay the miner the subsidy and collected fees
+    minerBalance, err := bc.Accounts[coinbase.To].Add(coinbase.Amount)
+    if err != nil {
+        return err
+    }
+    bc.Accounts[coinbase.To] = minerBalance
+    
+    return nil
+}
+
+func (bc *Blockchain) processTransaction(tx *Transaction) error {
+    total, err := tx.Amount.Add(tx.Fee)
+    if err != nil {
+        return err
+    }
+    
     // Deduct from sender
-    bc.Accounts[tx.From] -= tx.Amount + tx.Fee
+    senderBalance, err := bc.Accounts[tx.From].Sub(total)
+    if err != nil {
+        return fmt.Errorf("insufficient balance: %v", err)
+    }
+    bc.Accounts[tx.From] = senderBalance
+    
     // Add to recipient
-    bc.Accounts[tx.To] += tx.Amount
-    // Miner gets the fee (will be added when block is processed)
+    recipientBalance, err := bc.Accounts[tx.To].Add(tx.Amount)
+    if err != nil {
+        return err
+    }
+    bc.Accounts[tx.To] = recipientBalance
+    
+    // Consume the sender's nonce
+    bc.Nonces[tx.From]++
+    // The fee is paid to the miner by the block's coinbase
+    return nil
+}
+
+// nextNonce returns the next nonce for an address including pooled transactions
+func (bc *Blockchain) nextNonce(address string) int64 {
+    nonce := bc.Nonces[address]
+    for _, tx := range bc.TransactionPool {
+        if tx.From == address && tx.Nonce >= nonce {
+            nonce = tx.Nonce + 1
+        }
+    }
+    return nonce
+}
+
+// pendingOutflow returns the amounts and fees an address spends in pooled
+// transactions
+func (bc *Blockchain) pendingOutflow(address string) (Amount, error) {
+    var outflow Amount
+    for _, tx := range bc.TransactionPool {
+        if tx.From != address {
+            continue
+        }
+        total, err := tx.Amount.Add(tx.Fee)
+        if err != nil {
+            return 0, err
+        }
+        if outflow, err = outflow.Add(total); err != nil {
+            return 0, err
+        }
+    }
+    return outflow, nil
 }
 
 func (bc *Blockchain) removeProcessedTransactions(processed []*Transaction) {
@@ -238,7 +733,8 @@ func (bc *Blockchain) removeProcessedTransactions(processed []*Transaction) {
     }
     
     for _, tx := range bc.TransactionPool {
-        if !processedMap[tx.Hash] {
+        // Drop included transactions and any whose nonce is now used
+        if !processedMap[tx.Hash] && tx.Nonce >= bc.Nonces[tx.From] {
             remaining = append(remaining, tx)
         }
     }
@@ -246,14 +742,57 @@ func (bc *Blockchain) removeProcessedTransactions(processed []*Transaction) {
     bc.TransactionPool = remaining
 }
 
+// getTransactionsForBlock picks up to 100 pooled transactions in pool order.
+// Each one is applied to a copy of the touched balances and nonces, and
+// skipped if it would not be valid after the ones picked before it, so the
+// template never contains a combination of spends the chain would reject.
 func (bc *Blockchain) getTransactionsForBlock() []*Transaction {
-    // Simple implementation: take first 100 transactions
     // In production, this would prioritize by fee
     maxTransactions := 100
-    if len(bc.TransactionPool) < maxTransactions {
-        return bc.TransactionPool
+    
+    balances := make(map[string]Amount)
+    nonces := make(map[string]int64)
+    balance := func(address string) Amount {
+        if amount, seen := balances[address]; seen {
+            return amount
+        }
+        return bc.Accounts[address]
+    }
+    nonce := func(address string) int64 {
+        if n, seen := nonces[address]; seen {
+            return n
+        }
+        return bc.Nonces[address]
+    }
+    
+    var transactions []*Transaction
+    for _, tx := range bc.TransactionPool {
+        if len(transactions) >= maxTransactions {
+            break
+        }
+        if tx.Nonce != nonce(tx.From) {
+            continue
+        }
+        total, err := tx.Amount.Add(tx.Fee)
+        if err != nil {
+            continue
+        }
+        senderBalance, err := balance(tx.From).Sub(total)
+        if err != nil {
+            continue
+        }
+        balances[tx.From] = senderBalance
+        recipientBalance, err := balance(tx.To).Add(tx.Amount)
+        if err != nil {
+            // Undo the debit, the transaction is left out
+            balances[tx.From], _ = senderBalance.Add(total)
+            continue
+        }
+        balances[tx.To] = recipientBalance
+        nonces[tx.From] = tx.Nonce + 1
+        transactions = append(transactions, tx)
     }
-    return bc.TransactionPool[:maxTransactions]
+    return transactions
 }
 
 // GetChainInfo returns basic blockchain information
@@ -262,10 +801,13 @@ func (bc *Blockchain) GetChainInfo() map[string]interface{} {
     defer bc.mutex.RUnlock()
     
     return map[string]interface{}{
-        "height":          len(bc.Chain),
-        "difficulty":      bc.Difficulty,
-        "block_reward":    bc.BlockReward,
+        "height":          bc.Chain[len(bc.Chain)-1].Index,
+        "bits":            bc.nextBits(),
+        "difficulty":      Difficulty(bc.nextBits(), bc.Retarget.PowLimitBits),
+        "chain_work":      bc.chainWork(len(bc.Chain) - 1).String(),
+        "block_reward":    bc.Emission.Subsidy(len(bc.Chain)),
         "pending_txs":     len(bc.TransactionPool),
+        "orphan_blocks":   len(bc.orphans.byHash),
         "total_accounts":  len(bc.Accounts),
         "last_block_hash": bc.Chain[len(bc.Chain)-1].Hash,
     }
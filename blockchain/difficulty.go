@@ -0,0 +1,134 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// medianTimeSpan is the number of previous blocks whose median timestamp a
+// new block must exceed, so that timestamps driving retargeting stay monotonic
+const medianTimeSpan = 11
+
+// maxRetargetFactor bounds how far a single retarget may move the target
+const maxRetargetFactor = 4
+
+// RetargetPolicy controls how the target adapts to the observed block rate.
+// The target is recomputed at the start of every window of RetargetInterval
+// blocks from the time the previous window took to mine.
+type RetargetPolicy struct {
+	TargetBlockTime  time.Duration `json:"target_block_time"` // Desired time between blocks
+	RetargetInterval int           `json:"retarget_interval"` // Blocks per window, 0 keeps the target fixed
+	PowLimitBits     uint32        `json:"pow_limit_bits"`    // Easiest target retargeting may reach
+}
+
+// Validate checks that the policy is well formed
+func (p RetargetPolicy) Validate() error {
+	if p.RetargetInterval < 0 || p.RetargetInterval == 1 {
+		return fmt.Errorf("invalid retarget interval: %d", p.RetargetInterval)
+	}
+	if p.RetargetInterval > 0 && p.TargetBlockTime <= 0 {
+		return fmt.Errorf("invalid target block time: %s", p.TargetBlockTime)
+	}
+	if CompactToTarget(p.PowLimitBits).Sign() <= 0 {
+		return fmt.Errorf("invalid proof-of-work limit: %#08x", p.PowLimitBits)
+	}
+	return nil
+}
+
+// Retarget returns the compact target for the next window given the current
+// one and the seconds the last window of blocks actually took. The target
+// scales with the ratio of actual to expected time, by at most a factor of 4
+// per window, and never becomes easier than the proof-of-work limit.
+func (p RetargetPolicy) Retarget(bits uint32, actualSeconds int64) uint32 {
+	expected := int64(p.RetargetInterval-1) * int64(p.TargetBlockTime/time.Second)
+	if expected <= 0 {
+		return bits
+	}
+
+	actualSeconds = max(actualSeconds, expected/maxRetargetFactor, 1)
+	actualSeconds = min(actualSeconds, expected*maxRetargetFactor)
+
+	target := CompactToTarget(bits)
+	target.Mul(target, big.NewInt(actualSeconds))
+	target.Div(target, big.NewInt(expected))
+
+	if limit := CompactToTarget(p.PowLimitBits); target.Cmp(limit) > 0 {
+		target = limit
+	}
+	return TargetToCompact(target)
+}
+
+// expectedBits returns the compact target the block at height must commit to
+func (bc *Blockchain) expectedBits(height int) (uint32, error) {
+	if height <= 0 {
+		return bc.GenesisBits, nil
+	}
+	if height > len(bc.Chain) {
+		return 0, fmt.Errorf("height %d is beyond the chain tip", height)
+	}
+
+	ancestor := func(height int) *BlockHeader { return &bc.Chain[height].BlockHeader }
+	return bc.bitsAfter(&bc.Chain[height-1].BlockHeader, ancestor), nil
+}
+
+// bitsAfter returns the compact target of the block following prev, where
+// ancestor returns the header at a lower height on prev's own branch. It lets
+// side branches and downloaded headers be checked against the target of
+// their branch rather than of the main chain.
+func (bc *Blockchain) bitsAfter(prev *BlockHeader, ancestor func(height int) *BlockHeader) uint32 {
+	height := prev.Index + 1
+	interval := bc.Retarget.RetargetInterval
+	if interval == 0 || height%interval != 0 {
+		return prev.Bits
+	}
+
+	first := ancestor(height - interval)
+	return bc.Retarget.Retarget(prev.Bits, prev.Timestamp-first.Timestamp)
+}
+
+// ExpectedBits returns the compact target required of the block at height
+func (bc *Blockchain) ExpectedBits(height int) (uint32, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	return bc.expectedBits(height)
+}
+
+// GetNextBits returns the compact target the next mined block must meet
+func (bc *Blockchain) GetNextBits() uint32 {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	return bc.nextBits()
+}
+
+// GetNextDifficulty returns the difficulty of the next block relative to the
+// proof-of-work limit
+func (bc *Blockchain) GetNextDifficulty() float64 {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	return Difficulty(bc.nextBits(), bc.Retarget.PowLimitBits)
+}
+
+func (bc *Blockchain) nextBits() uint32 {
+	bits, _ := bc.expectedBits(len(bc.Chain))
+	return bits
+}
+
+// medianTimePast returns the median timestamp of the blocks before height
+func (bc *Blockchain) medianTimePast(height int) int64 {
+	start := height - medianTimeSpan
+	if start < 0 {
+		start = 0
+	}
+
+	timestamps := make([]int64, 0, height-start)
+	for _, block := range bc.Chain[start:height] {
+		timestamps = append(timestamps, block.Timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
@@ -0,0 +1,87 @@
+package blockchain
+
+import (
+	"fmt"
+	"math"
+)
+
+// EmissionSchedule is the monetary policy that determines the block subsidy
+// at every height. The genesis allocation is not part of the schedule; it only
+// covers coins created by mined blocks, starting at height 1.
+type EmissionSchedule struct {
+	InitialReward   Amount `json:"initial_reward"`   // Subsidy of the first era
+	HalvingInterval int    `json:"halving_interval"` // Blocks per era, 0 disables halving
+	TailEmission    Amount `json:"tail_emission"`    // Floor the subsidy never halves below
+	MaxSupply       Amount `json:"max_supply"`       // Cap on coins emitted by blocks, 0 for no cap
+}
+
+// NewEmissionSchedule creates a schedule with a constant reward and no cap
+func NewEmissionSchedule(reward Amount) EmissionSchedule {
+	return EmissionSchedule{InitialReward: reward}
+}
+
+// Validate checks that the schedule is well formed
+func (s EmissionSchedule) Validate() error {
+	if s.HalvingInterval < 0 {
+		return fmt.Errorf("invalid halving interval: %d", s.HalvingInterval)
+	}
+	return nil
+}
+
+// Subsidy returns the number of new coins the block at the given height may mint
+func (s EmissionSchedule) Subsidy(height int) Amount {
+	if height <= 0 {
+		return 0
+	}
+	return s.Emitted(height) - s.Emitted(height-1)
+}
+
+// Emitted returns the total subsidy of all blocks up to and including height
+func (s EmissionSchedule) Emitted(height int) Amount {
+	if height <= 0 {
+		return 0
+	}
+
+	var total Amount
+	if s.HalvingInterval == 0 {
+		total = saturatingMul(s.eraReward(0), uint64(height))
+	} else {
+		remaining := uint64(height)
+		for era := 0; remaining > 0; era++ {
+			blocks := uint64(s.HalvingInterval)
+			// Once the tail is reached every later era pays the same
+			if s.InitialReward>>uint(era) <= s.TailEmission {
+				blocks = remaining
+			}
+			blocks = min(blocks, remaining)
+			total = saturatingAdd(total, saturatingMul(s.eraReward(era), blocks))
+			remaining -= blocks
+		}
+	}
+
+	if s.MaxSupply > 0 && total > s.MaxSupply {
+		return s.MaxSupply
+	}
+	return total
+}
+
+// eraReward returns the uncapped subsidy of each block in the given era
+func (s EmissionSchedule) eraReward(era int) Amount {
+	return max(s.InitialReward>>uint(era), s.TailEmission)
+}
+
+func saturatingAdd(a, b Amount) Amount {
+	sum, err := a.Add(b)
+	if err != nil {
+		return Amount(math.MaxUint64)
+	}
+	return sum
+}
+
+func saturatingMul(a Amount, n uint64) Amount {
+	product, err := a.Mul(n)
+	if err != nil {
+		return Amount(math.MaxUint64)
+	}
+	return product
+}
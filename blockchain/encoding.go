@@ -0,0 +1,301 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// EncodingVersion is the version byte that prefixes every binary encoding.
+// Any change to field order or types requires a new version.
+const EncodingVersion byte = 2
+
+// Limits applied while decoding untrusted data
+const (
+	maxEncodedStringLen  = 4096
+	maxBlockTransactions = 100000
+)
+
+// ErrTruncated is returned when binary data ends before a value is complete
+var ErrTruncated = errors.New("truncated binary data")
+
+// encoder builds a canonical binary encoding.
+// Integers are fixed-width big-endian; strings and nested objects are
+// prefixed with their length as an unsigned varint.
+type encoder struct {
+	buf []byte
+}
+
+func newEncoder() *encoder {
+	return &encoder{buf: []byte{EncodingVersion}}
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, v)
+}
+
+func (e *encoder) uint64(v uint64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+}
+
+func (e *encoder) int64(v int64) {
+	e.uint64(uint64(v))
+}
+
+func (e *encoder) bytes(v []byte) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) string(v string) {
+	e.bytes([]byte(v))
+}
+
+func (e *encoder) length(n int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(n))
+}
+
+// decoder reads a canonical binary encoding, remembering the first error
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func newDecoder(data []byte) *decoder {
+	d := &decoder{data: data}
+	if len(data) == 0 {
+		d.err = ErrTruncated
+	} else if data[0] != EncodingVersion {
+		d.err = fmt.Errorf("unsupported encoding version: %d", data[0])
+	} else {
+		d.data = data[1:]
+	}
+	return d
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data) {
+		d.err = ErrTruncated
+		return nil
+	}
+	v := d.data[:n]
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) uint32() uint32 {
+	v := d.take(4)
+	if v == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(v)
+}
+
+func (d *decoder) uint64() uint64 {
+	v := d.take(8)
+	if v == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+func (d *decoder) int64() int64 {
+	return int64(d.uint64())
+}
+
+func (d *decoder) length(max int) int {
+	if d.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(d.data)
+	if size <= 0 {
+		d.err = ErrTruncated
+		return 0
+	}
+	if n > uint64(max) {
+		d.err = fmt.Errorf("length %d exceeds limit %d", n, max)
+		return 0
+	}
+	d.data = d.data[size:]
+	return int(n)
+}
+
+func (d *decoder) bytes(max int) []byte {
+	n := d.length(max)
+	v := d.take(n)
+	if v == nil {
+		return nil
+	}
+	return append([]byte(nil), v...)
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes(maxEncodedStringLen))
+}
+
+// finish reports the first decoding error, or trailing data
+func (d *decoder) finish() error {
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.data) != 0 {
+		return fmt.Errorf("%d bytes of trailing data", len(d.data))
+	}
+	return nil
+}
+
+// signingBytes returns the encoding of the fields covered by the transaction hash
+func (tx *Transaction) signingBytes() []byte {
+	e := newEncoder()
+	tx.encodeSigningFields(e)
+	return e.buf
+}
+
+func (tx *Transaction) encodeSigningFields(e *encoder) {
+	e.uint32(uint32(tx.Version))
+	e.string(tx.From)
+	e.string(tx.To)
+	e.uint64(uint64(tx.Amount))
+	e.uint64(uint64(tx.Fee))
+	e.int64(tx.Nonce)
+	e.int64(tx.Timestamp)
+}
+
+// MarshalBinary returns the canonical binary encoding of the transaction.
+// The hash is not encoded; it is recomputed when decoding.
+func (tx *Transaction) MarshalBinary() ([]byte, error) {
+	e := newEncoder()
+	tx.encodeSigningFields(e)
+	e.string(tx.PublicKey)
+	e.string(tx.Signature)
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a transaction produced by MarshalBinary
+func (tx *Transaction) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data)
+	decoded := Transaction{
+		Version:   int(d.uint32()),
+		From:      d.string(),
+		To:        d.string(),
+		Amount:    Amount(d.uint64()),
+		Fee:       Amount(d.uint64()),
+		Nonce:     d.int64(),
+		Timestamp: d.int64(),
+		PublicKey: d.string(),
+		Signature: d.string(),
+		Status:    "pending",
+	}
+	if err := d.finish(); err != nil {
+		return fmt.Errorf("invalid transaction encoding: %v", err)
+	}
+
+	decoded.Hash = decoded.CalculateHash()
+	*tx = decoded
+	return nil
+}
+
+// headerBytes returns the encoding of the fields covered by the block hash
+func (h *BlockHeader) headerBytes() []byte {
+	e := newEncoder()
+	h.encodeFields(e)
+	return e.buf
+}
+
+func (h *BlockHeader) encodeFields(e *encoder) {
+	e.uint32(uint32(h.Version))
+	e.uint64(uint64(h.Index))
+	e.int64(h.Timestamp)
+	e.string(h.PrevHash)
+	e.string(h.MerkleRoot)
+	e.int64(h.Nonce)
+	e.uint64(h.ExtraNonce)
+	e.uint32(h.Bits)
+	e.string(h.Miner)
+	e.uint64(uint64(h.BlockReward))
+}
+
+func (h *BlockHeader) decodeFields(d *decoder) {
+	h.Version = int(d.uint32())
+	h.Index = int(d.uint64())
+	h.Timestamp = d.int64()
+	h.PrevHash = d.string()
+	h.MerkleRoot = d.string()
+	h.Nonce = d.int64()
+	h.ExtraNonce = d.uint64()
+	h.Bits = d.uint32()
+	h.Miner = d.string()
+	h.BlockReward = Amount(d.uint64())
+}
+
+// MarshalBinary returns the canonical binary encoding of the header.
+// It is the exact preimage of the block hash.
+func (h *BlockHeader) MarshalBinary() ([]byte, error) {
+	return h.headerBytes(), nil
+}
+
+// UnmarshalBinary decodes a header produced by MarshalBinary
+func (h *BlockHeader) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data)
+	var decoded BlockHeader
+	decoded.decodeFields(d)
+	if err := d.finish(); err != nil {
+		return fmt.Errorf("invalid block header encoding: %v", err)
+	}
+
+	*h = decoded
+	return nil
+}
+
+// MarshalBinary returns the canonical binary encoding of the block:
+// the header fields followed by the transactions.
+// The block hash is not encoded; it is recomputed when decoding.
+func (b *Block) MarshalBinary() ([]byte, error) {
+	e := newEncoder()
+	b.BlockHeader.encodeFields(e)
+
+	e.length(len(b.Transactions))
+	for _, tx := range b.Transactions {
+		txData, err := tx.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		e.bytes(txData)
+	}
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a block produced by MarshalBinary
+func (b *Block) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data)
+	var decoded Block
+	decoded.BlockHeader.decodeFields(d)
+
+	count := d.length(maxBlockTransactions)
+	decoded.Transactions = make([]*Transaction, 0, count)
+	for i := 0; i < count && d.err == nil; i++ {
+		txData := d.bytes(len(d.data))
+		if d.err != nil {
+			break
+		}
+		tx := &Transaction{}
+		if err := tx.UnmarshalBinary(txData); err != nil {
+			return fmt.Errorf("invalid block encoding: transaction %d: %v", i, err)
+		}
+		decoded.Transactions = append(decoded.Transactions, tx)
+	}
+	if err := d.finish(); err != nil {
+		return fmt.Errorf("invalid block encoding: %v", err)
+	}
+
+	decoded.Hash = decoded.CalculateHash()
+	for _, tx := range decoded.Transactions {
+		tx.Status = "confirmed"
+		tx.BlockHash = decoded.Hash
+	}
+	*b = decoded
+	return nil
+}
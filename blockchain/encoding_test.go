@@ -0,0 +1,285 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Fixed fixtures, so that their encodings can be compared against golden
+// vectors. Any change to the encoding shows up as a golden vector mismatch.
+
+func testTransaction() *Transaction {
+	tx := &Transaction{
+		Version:   1,
+		From:      "alice",
+		To:        "bob",
+		Amount:    1500,
+		Fee:       25,
+		Nonce:     7,
+		Timestamp: 1700000000,
+		PublicKey: "pk",
+		Signature: "sig",
+		Status:    "pending",
+	}
+	tx.Hash = tx.CalculateHash()
+	return tx
+}
+
+func testCoinbase() *Transaction {
+	tx := &Transaction{
+		Version:   1,
+		From:      CoinbaseAddress,
+		To:        "miner",
+		Amount:    5000,
+		Nonce:     1,
+		Timestamp: 1700000000,
+		Status:    "pending",
+	}
+	tx.Hash = tx.CalculateHash()
+	return tx
+}
+
+func testHeader() BlockHeader {
+	return BlockHeader{
+		Version:     1,
+		Index:       1,
+		Timestamp:   1700000600,
+		PrevHash:    "00ff",
+		MerkleRoot:  "abcd",
+		Nonce:       42,
+		ExtraNonce:  3,
+		Bits:        0x207fffff,
+		Miner:       "miner",
+		BlockReward: 5000,
+	}
+}
+
+func testBlock() *Block {
+	block := &Block{
+		BlockHeader:  testHeader(),
+		Transactions: []*Transaction{testCoinbase(), testTransaction()},
+	}
+	block.MerkleRoot = block.CalculateMerkleRoot()
+	block.Hash = block.CalculateHash()
+	return block
+}
+
+func TestTransactionRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		tx   *Transaction
+	}{
+		{"signed", testTransaction()},
+		{"coinbase", testCoinbase()},
+		{"empty", &Transaction{Status: "pending"}},
+		{"negative nonce and timestamp", &Transaction{Version: 1, From: "a", To: "b", Nonce: -1, Timestamp: -1, Status: "pending"}},
+		{"unicode strings", &Transaction{Version: 1, From: "äöü", To: "日本", PublicKey: "🔑", Status: "pending"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := test.tx.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary: %v", err)
+			}
+
+			var decoded Transaction
+			if err := decoded.UnmarshalBinary(data); err != nil {
+				t.Fatalf("UnmarshalBinary: %v", err)
+			}
+
+			want := *test.tx
+			want.Hash = want.CalculateHash()
+			if !reflect.DeepEqual(decoded, want) {
+				t.Errorf("decoded %+v, want %+v", decoded, want)
+			}
+
+			again, _ := decoded.MarshalBinary()
+			if !bytes.Equal(again, data) {
+				t.Errorf("re-encoding differs:\n got %x\nwant %x", again, data)
+			}
+		})
+	}
+}
+
+func TestBlockHeaderRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		header BlockHeader
+	}{
+		{"full", testHeader()},
+		{"zero", BlockHeader{}},
+		{"limits", BlockHeader{Version: 1, Index: 1 << 40, Timestamp: -1, Nonce: -1, ExtraNonce: ^uint64(0), Bits: ^uint32(0), BlockReward: Amount(^uint64(0))}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := test.header.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary: %v", err)
+			}
+
+			var decoded BlockHeader
+			if err := decoded.UnmarshalBinary(data); err != nil {
+				t.Fatalf("UnmarshalBinary: %v", err)
+			}
+			if decoded != test.header {
+				t.Errorf("decoded %+v, want %+v", decoded, test.header)
+			}
+			if decoded.CalculateHash() != test.header.CalculateHash() {
+				t.Errorf("hash changed by round trip")
+			}
+		})
+	}
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		block *Block
+	}{
+		{"with transactions", testBlock()},
+		{"coinbase only", &Block{BlockHeader: testHeader(), Transactions: []*Transaction{testCoinbase()}}},
+		{"no transactions", &Block{BlockHeader: testHeader(), Transactions: []*Transaction{}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := test.block.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary: %v", err)
+			}
+
+			var decoded Block
+			if err := decoded.UnmarshalBinary(data); err != nil {
+				t.Fatalf("UnmarshalBinary: %v", err)
+			}
+
+			if decoded.BlockHeader != test.block.BlockHeader {
+				t.Errorf("header %+v, want %+v", decoded.BlockHeader, test.block.BlockHeader)
+			}
+			if decoded.Hash != test.block.CalculateHash() {
+				t.Errorf("hash %s, want %s", decoded.Hash, test.block.CalculateHash())
+			}
+			if len(decoded.Transactions) != len(test.block.Transactions) {
+				t.Fatalf("%d transactions, want %d", len(decoded.Transactions), len(test.block.Transactions))
+			}
+			for i, tx := range decoded.Transactions {
+				want := *test.block.Transactions[i]
+				want.Status = "confirmed"
+				want.BlockHash = decoded.Hash
+				if !reflect.DeepEqual(*tx, want) {
+					t.Errorf("transaction %d: %+v, want %+v", i, *tx, want)
+				}
+			}
+			if decoded.CalculateMerkleRoot() != test.block.CalculateMerkleRoot() {
+				t.Errorf("merkle root changed by round trip")
+			}
+		})
+	}
+}
+
+func TestEncodingGoldenVectors(t *testing.T) {
+	tests := []struct {
+		name     string
+		marshal  func() ([]byte, error)
+		hash     func() string
+		encoding string
+		wantHash string
+	}{
+		{
+			name:     "transaction",
+			marshal:  testTransaction().MarshalBinary,
+			hash:     testTransaction().CalculateHash,
+			encoding: "020000000105616c69636503626f6200000000000005dc00000000000000190000000000000007000000006553f10002706b03736967",
+			wantHash: "813ea0d6a2b5abd8b684e232f7cc80586fc1ae2a69e514676328c8759a87eb23",
+		},
+		{
+			name:     "transaction witness",
+			marshal:  testTransaction().MarshalBinary,
+			hash:     testTransaction().WitnessHash,
+			encoding: "020000000105616c69636503626f6200000000000005dc00000000000000190000000000000007000000006553f10002706b03736967",
+			wantHash: "69132164c39bd0f1a78a41ebbbe4c5eaddb95addb01c912842683cb4c94e1f4b",
+		},
+		{
+			name:     "coinbase",
+			marshal:  testCoinbase().MarshalBinary,
+			hash:     testCoinbase().CalculateHash,
+			encoding: "02000000010130056d696e6572000000000000138800000000000000000000000000000001000000006553f1000000",
+			wantHash: "3a9b3948f35aa007040a5ba6bd3b57b015eafdbf414fc81383183baa65fcf16e",
+		},
+		{
+			name:     "block header",
+			marshal:  func() ([]byte, error) { header := testHeader(); return header.MarshalBinary() },
+			hash:     func() string { header := testHeader(); return header.CalculateHash() },
+			encoding: "02000000010000000000000001000000006553f35804303066660461626364000000000000002a0000000000000003207fffff056d696e65720000000000001388",
+			wantHash: "d40a99887dc28442aa7feeb75607076583484a1cef1beee4288393f834ba930d",
+		},
+		{
+			name:     "block",
+			marshal:  testBlock().MarshalBinary,
+			hash:     func() string { return testBlock().Hash },
+			encoding: "02000000010000000000000001000000006553f35804303066664039653363623566643864383139666633313431356637366362393263633863616534646464386139616534316665386437643639393134303030386635653535000000000000002a0000000000000003207fffff056d696e65720000000000001388022f02000000010130056d696e6572000000000000138800000000000000000000000000000001000000006553f100000036020000000105616c69636503626f6200000000000005dc00000000000000190000000000000007000000006553f10002706b03736967",
+			wantHash: "adcb98777391ccacf1cec9950a479df03b035069f98fe40689860473f5e78dc1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := test.marshal()
+			if err != nil {
+				t.Fatalf("MarshalBinary: %v", err)
+			}
+			if got := hex.EncodeToString(data); got != test.encoding {
+				t.Errorf("encoding\n got %s\nwant %s", got, test.encoding)
+			}
+			if got := test.hash(); got != test.wantHash {
+				t.Errorf("hash %s, want %s", got, test.wantHash)
+			}
+		})
+	}
+}
+
+func TestUnmarshalRejectsMalformedData(t *testing.T) {
+	txData, _ := testTransaction().MarshalBinary()
+	headerData, _ := testBlock().BlockHeader.MarshalBinary()
+	blockData, _ := testBlock().MarshalBinary()
+
+	wrongVersion := func(data []byte) []byte {
+		data = append([]byte(nil), data...)
+		data[0] = EncodingVersion + 1
+		return data
+	}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		unmarshal func([]byte) error
+		truncated bool
+	}{
+		{"empty transaction", nil, new(Transaction).UnmarshalBinary, true},
+		{"truncated transaction", txData[:len(txData)-1], new(Transaction).UnmarshalBinary, true},
+		{"transaction with trailing data", append(append([]byte(nil), txData...), 0), new(Transaction).UnmarshalBinary, false},
+		{"transaction of unknown version", wrongVersion(txData), new(Transaction).UnmarshalBinary, false},
+		{"truncated header", headerData[:10], new(BlockHeader).UnmarshalBinary, true},
+		{"header with trailing data", append(append([]byte(nil), headerData...), 0), new(BlockHeader).UnmarshalBinary, false},
+		{"truncated block", blockData[:len(blockData)-1], new(Block).UnmarshalBinary, true},
+		{"block of unknown version", wrongVersion(blockData), new(Block).UnmarshalBinary, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.unmarshal(test.data)
+			if err == nil {
+				t.Fatal("malformed data was decoded")
+			}
+			// Decoding errors are wrapped with %v, so match the message
+			if test.truncated && !strings.Contains(err.Error(), ErrTruncated.Error()) {
+				t.Errorf("error %v, want %v", err, ErrTruncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,402 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	// maxReorgHistory is the number of reorganization events kept for the API
+	maxReorgHistory = 100
+
+	// maxReorgDepth is how far below the tip a side branch may fork. Deeper
+	// branches are refused and pruned, as are branches lagging the tip by more
+	// than this many blocks' worth of work.
+	maxReorgDepth = 100
+
+	// maxSideBlocks bounds the blocks kept outside the main chain
+	maxSideBlocks = 1000
+)
+
+// blockNode is an entry of the block tree, which holds the main chain and
+// every side branch whose headers carry valid proof of work
+type blockNode struct {
+	block   *Block
+	parent  *blockNode
+	work    *big.Int // Cumulative work from genesis up to and including this block
+	invalid bool     // Failed full validation, as do all its descendants
+}
+
+// ReorgEvent records a switch of the main chain to a heavier branch
+type ReorgEvent struct {
+	Time                 int64    `json:"time"`
+	ForkHeight           int      `json:"fork_height"`
+	ForkHash             string   `json:"fork_hash"`
+	OldTip               string   `json:"old_tip"`
+	NewTip               string   `json:"new_tip"`
+	Disconnected         []string `json:"disconnected"` // Hashes of blocks removed from the main chain
+	Connected            []string `json:"connected"`    // Hashes of blocks added to the main chain
+	ReturnedTransactions int      `json:"returned_transactions"`
+}
+
+// GetReorgs returns the most recent reorganization events, oldest first
+func (bc *Blockchain) GetReorgs() []ReorgEvent {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	return append([]ReorgEvent(nil), bc.reorgs...)
+}
+
+// GetSideBlockCount returns the number of known blocks outside the main chain
+func (bc *Blockchain) GetSideBlockCount() int {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	bc.syncIndex()
+	return len(bc.blocks) - len(bc.Chain)
+}
+
+// syncIndex makes sure every main chain block is in the block tree, which is
+// needed after the chain was created or loaded without going through AddBlock
+func (bc *Blockchain) syncIndex() {
+	if bc.blocks == nil {
+		bc.blocks = make(map[string]*blockNode)
+		bc.txIndex = make(map[string]string)
+	}
+	if _, indexed := bc.blocks[bc.Chain[len(bc.Chain)-1].Hash]; indexed {
+		return
+	}
+
+	var parent *blockNode
+	for _, block := range bc.Chain {
+		node, indexed := bc.blocks[block.Hash]
+		if !indexed {
+			node = bc.indexBlock(block, parent)
+		}
+		parent = node
+	}
+}
+
+// indexBlock adds a block to the block tree below its parent
+func (bc *Blockchain) indexBlock(block *Block, parent *blockNode) *blockNode {
+	work := block.Work()
+	if parent != nil {
+		work.Add(work, parent.work)
+	}
+
+	node := &blockNode{block: block, parent: parent, work: work}
+	bc.blocks[block.Hash] = node
+	for _, tx := range block.Transactions {
+		bc.txIndex[tx.Hash] = block.Hash
+	}
+	return node
+}
+
+// addSideBlock stores a block that does not extend the tip and reorganizes
+// to its branch if that branch now has the most cumulative work.
+// Only the header is checked here, against its own branch, and branches too
+// deep or too far behind the tip are refused; the branch is fully validated
+// when it becomes the main chain.
+func (bc *Blockchain) addSideBlock(block *Block) error {
+	parent, known := bc.blocks[block.PrevHash]
+	if !known {
+		return fmt.Errorf("unknown parent block %s", block.PrevHash)
+	}
+	if parent.invalid {
+		return fmt.Errorf("parent block %s is invalid", block.PrevHash)
+	}
+	if block.Index != parent.block.Index+1 {
+		return fmt.Errorf("block height %d does not follow parent height %d", block.Index, parent.block.Index)
+	}
+	if block.Hash != block.CalculateHash() {
+		return fmt.Errorf("block hash does not match its header")
+	}
+	if expected := bc.expectedBitsAfter(parent); block.Bits != expected {
+		return fmt.Errorf("target bits %#08x, expected %#08x on its branch", block.Bits, expected)
+	}
+	if err := bc.checkProofOfWork(&block.BlockHeader); err != nil {
+		return err
+	}
+	if block.MerkleRoot != block.CalculateMerkleRoot() {
+		return fmt.Errorf("merkle root does not match transactions")
+	}
+
+	// Refuse branches that fork too deep or are too far behind to matter
+	tip := bc.blocks[bc.Chain[len(bc.Chain)-1].Hash]
+	if depth := tip.block.Index - bc.forkPoint(parent).block.Index; depth > maxReorgDepth {
+		return fmt.Errorf("side branch forks %d blocks below the tip, more than %d", depth, maxReorgDepth)
+	}
+	work := new(big.Int).Add(parent.work, block.Work())
+	lag := new(big.Int).Sub(tip.work, work)
+	if lag.Cmp(new(big.Int).Mul(tip.block.Work(), big.NewInt(maxReorgDepth))) > 0 {
+		return fmt.Errorf("side branch is more than %d blocks of work behind the tip", maxReorgDepth)
+	}
+
+	bc.pruneSideBlocks()
+	if len(bc.blocks)-len(bc.Chain) >= maxSideBlocks {
+		return fmt.Errorf("side block limit of %d reached", maxSideBlocks)
+	}
+
+	node := bc.indexBlock(block, parent)
+	if node.work.Cmp(tip.work) <= 0 {
+		fmt.Printf("🌿 Stored side branch block %d (%s)\n", block.Index, block.Hash[:16])
+		return nil
+	}
+
+	return bc.reorganize(node)
+}
+
+// expectedBitsAfter returns the compact target a child of a block tree node
+// must commit to, following the node's own branch
+func (bc *Blockchain) expectedBitsAfter(parent *blockNode) uint32 {
+	ancestor := func(height int) *BlockHeader {
+		node := parent
+		for node.block.Index > height {
+			node = node.parent
+		}
+		return &node.block.BlockHeader
+	}
+	return bc.bitsAfter(&parent.block.BlockHeader, ancestor)
+}
+
+// forkPoint returns the last main chain block on a node's branch
+func (bc *Blockchain) forkPoint(node *blockNode) *blockNode {
+	for !bc.onMainChain(node) {
+		node = node.parent
+	}
+	return node
+}
+
+// pruneSideBlocks forgets side branch blocks that fork more than
+// maxReorgDepth below the tip, since they can no longer become main chain
+func (bc *Blockchain) pruneSideBlocks() {
+	if len(bc.blocks)-len(bc.Chain) < maxSideBlocks {
+		return
+	}
+
+	tipHeight := len(bc.Chain) - 1
+	for hash, node := range bc.blocks {
+		if bc.onMainChain(node) {
+			continue
+		}
+		if tipHeight-bc.forkPoint(node).block.Index > maxReorgDepth {
+			delete(bc.blocks, hash)
+			for _, tx := range node.block.Transactions {
+				if bc.txIndex[tx.Hash] == hash {
+					delete(bc.txIndex, tx.Hash)
+				}
+			}
+		}
+	}
+}
+
+// reorganize makes the branch ending at newTip the main chain. Blocks of the
+// old branch are reverted down to the fork point, the new branch is validated
+// and applied, and transactions only found in the old branch are returned to
+// the pool. If any new block is invalid the old branch is restored.
+func (bc *Blockchain) reorganize(newTip *blockNode) error {
+	// Walk back to the fork point on the main chain
+	var branch []*blockNode
+	fork := newTip
+	for !bc.onMainChain(fork) {
+		if fork.invalid {
+			return fmt.Errorf("branch contains invalid block %s", fork.block.Hash)
+		}
+		branch = append([]*blockNode{fork}, branch...)
+		fork = fork.parent
+	}
+	forkHeight := fork.block.Index
+	oldBranch := append([]*Block(nil), bc.Chain[forkHeight+1:]...)
+	oldTip := bc.Chain[len(bc.Chain)-1].Hash
+
+	if err := bc.disconnectTo(forkHeight); err != nil {
+		// Reapply the blocks that were already reverted
+		height := len(bc.Chain) - 1
+		if restoreErr := bc.restoreBranch(height, oldBranch[height-forkHeight:]); restoreErr != nil {
+			return fmt.Errorf("failed to restore chain after failing to revert to fork point %d: %v", forkHeight, restoreErr)
+		}
+		return fmt.Errorf("failed to revert to fork point %d: %v", forkHeight, err)
+	}
+
+	for i, node := range branch {
+		if err := bc.connectBlock(node.block); err != nil {
+			// Reject the block with its descendants and restore the old branch
+			for _, invalid := range branch[i:] {
+				invalid.invalid = true
+			}
+			if restoreErr := bc.restoreBranch(forkHeight, oldBranch); restoreErr != nil {
+				return fmt.Errorf("failed to restore chain after invalid block %s: %v", node.block.Hash, restoreErr)
+			}
+			return fmt.Errorf("reorganization failed at block %d: %v", node.block.Index, err)
+		}
+	}
+
+	// Return transactions that did not make it into the new branch
+	var connectedTxs []*Transaction
+	event := ReorgEvent{
+		Time:       time.Now().Unix(),
+		ForkHeight: forkHeight,
+		ForkHash:   fork.block.Hash,
+		OldTip:     oldTip,
+		NewTip:     newTip.block.Hash,
+	}
+	for _, node := range branch {
+		event.Connected = append(event.Connected, node.block.Hash)
+		connectedTxs = append(connectedTxs, node.block.Transactions...)
+	}
+	var returned []*Transaction
+	for _, block := range oldBranch {
+		event.Disconnected = append(event.Disconnected, block.Hash)
+		for _, tx := range block.Transactions[1:] {
+			tx.Status = "pending"
+			tx.BlockHash = ""
+			returned = append(returned, tx)
+		}
+	}
+
+	// Rebuild the pool through the checks of AddTransaction, returned
+	// transactions first, so that spends the new branch made unaffordable
+	// or whose nonce it used are dropped
+	connected := make(map[string]bool)
+	for _, tx := range connectedTxs {
+		connected[tx.Hash] = true
+	}
+	candidates := append(returned, bc.TransactionPool...)
+	bc.TransactionPool = nil
+	for i, tx := range candidates {
+		if connected[tx.Hash] || bc.addTransaction(tx) != nil {
+			continue
+		}
+		if i < len(returned) {
+			event.ReturnedTransactions++
+		}
+	}
+
+	bc.reorgs = append(bc.reorgs, event)
+	if len(bc.reorgs) > maxReorgHistory {
+		bc.reorgs = bc.reorgs[len(bc.reorgs)-maxReorgHistory:]
+	}
+
+	fmt.Printf("🔀 Reorganized chain at height %d: %d blocks disconnected, %d connected\n",
+		forkHeight, len(event.Disconnected), len(event.Connected))
+	return nil
+}
+
+// onMainChain reports whether the node's block is part of the main chain
+func (bc *Blockchain) onMainChain(node *blockNode) bool {
+	height := node.block.Index
+	return height < len(bc.Chain) && bc.Chain[height].Hash == node.block.Hash
+}
+
+// connectBlock fully validates a block extending the tip and applies it
+func (bc *Blockchain) connectBlock(block *Block) error {
+	if err := bc.validateHeader(&block.BlockHeader); err != nil {
+		return err
+	}
+	if err := bc.validateBody(block); err != nil {
+		return err
+	}
+	if err := bc.applyBlock(block); err != nil {
+		return err
+	}
+
+	bc.Chain = append(bc.Chain, block)
+	return nil
+}
+
+// disconnectTo reverts main chain blocks until height is the tip
+func (bc *Blockchain) disconnectTo(height int) error {
+	for len(bc.Chain)-1 > height {
+		block := bc.Chain[len(bc.Chain)-1]
+		if err := bc.revertBlock(block); err != nil {
+			return fmt.Errorf("block %d: %v", block.Index, err)
+		}
+		bc.Chain = bc.Chain[:len(bc.Chain)-1]
+	}
+	return nil
+}
+
+// restoreBranch replaces everything above height with a previously valid branch
+func (bc *Blockchain) restoreBranch(height int, branch []*Block) error {
+	if err := bc.disconnectTo(height); err != nil {
+		return err
+	}
+	for _, block := range branch {
+		if err := bc.applyBlock(block); err != nil {
+			return fmt.Errorf("block %d: %v", block.Index, err)
+		}
+		bc.Chain = append(bc.Chain, block)
+	}
+	return nil
+}
+
+// revertBlock undoes applyBlock, processing the block in reverse order. If
+// the block cannot be reverted the balances and nonces are left unchanged.
+func (bc *Blockchain) revertBlock(block *Block) (err error) {
+	coinbase := block.Coinbase()
+	if coinbase == nil {
+		return fmt.Errorf("missing coinbase transaction")
+	}
+
+	// Remember the touched accounts, so that a failure can be undone
+	accounts := make(map[string]Amount)
+	nonces := make(map[string]int64)
+	for _, tx := range block.Transactions {
+		for _, address := range []string{tx.From, tx.To} {
+			if balance, exists := bc.Accounts[address]; exists {
+				accounts[address] = balance
+			}
+			if nonce, exists := bc.Nonces[address]; exists {
+				nonces[address] = nonce
+			}
+		}
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, tx := range block.Transactions {
+			for _, address := range []string{tx.From, tx.To} {
+				delete(bc.Accounts, address)
+				delete(bc.Nonces, address)
+			}
+		}
+		for address, balance := range accounts {
+			bc.Accounts[address] = balance
+		}
+		for address, nonce := range nonces {
+			bc.Nonces[address] = nonce
+		}
+	}()
+
+	minerBalance, err := bc.Accounts[coinbase.To].Sub(coinbase.Amount)
+	if err != nil {
+		return err
+	}
+	bc.Accounts[coinbase.To] = minerBalance
+
+	for i := len(block.Transactions) - 1; i >= 1; i-- {
+		tx := block.Transactions[i]
+		total, err := tx.Amount.Add(tx.Fee)
+		if err != nil {
+			return err
+		}
+
+		recipientBalance, err := bc.Accounts[tx.To].Sub(tx.Amount)
+		if err != nil {
+			return fmt.Errorf("transaction %s: %v", tx.Hash, err)
+		}
+		bc.Accounts[tx.To] = recipientBalance
+
+		senderBalance, err := bc.Accounts[tx.From].Add(total)
+		if err != nil {
+			return fmt.Errorf("transaction %s: %v", tx.Hash, err)
+		}
+		bc.Accounts[tx.From] = senderBalance
+
+		bc.Nonces[tx.From]--
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// locatorDenseSpan is the number of most recent blocks listed one by one in a
+// block locator before the step between entries starts doubling
+const locatorDenseSpan = 10
+
+// BlockLocator returns main chain hashes describing our chain to a peer, from
+// the tip backwards: the last ten blocks one by one, then exponentially
+// further apart, always ending with the genesis block. A peer finds the most
+// recent hash it knows on its own main chain, which is the fork point.
+func (bc *Blockchain) BlockLocator() []string {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	var locator []string
+	step := 1
+	for height := len(bc.Chain) - 1; height > 0; height -= step {
+		locator = append(locator, bc.Chain[height].Hash)
+		if len(locator) >= locatorDenseSpan {
+			step *= 2
+		}
+	}
+	return append(locator, bc.Chain[0].Hash)
+}
+
+// HaveBlock reports whether a block is known, on the main chain, a side
+// branch or waiting in the orphan pool
+func (bc *Blockchain) HaveBlock(hash string) bool {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	bc.syncIndex()
+	if _, known := bc.blocks[hash]; known {
+		return true
+	}
+	_, orphan := bc.orphans.byHash[hash]
+	return orphan
+}
+
+// HaveTransaction reports whether a transaction is confirmed on the main
+// chain. A transaction only found in side branch blocks is not.
+func (bc *Blockchain) HaveTransaction(hash string) bool {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	bc.syncIndex()
+	node, known := bc.blocks[bc.txIndex[hash]]
+	return known && bc.onMainChain(node)
+}
+
+// LocateBlocks returns up to max main chain blocks following the fork point
+// described by a locator, stopping after stopHash if it is reached. Without a
+// known locator entry the blocks start right after the genesis block.
+func (bc *Blockchain) LocateBlocks(locator []string, stopHash string, max int) []*Block {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	start := bc.locateFork(locator) + 1
+	var blocks []*Block
+	for height := start; height < len(bc.Chain) && len(blocks) < max; height++ {
+		blocks = append(blocks, bc.Chain[height])
+		if bc.Chain[height].Hash == stopHash {
+			break
+		}
+	}
+	return blocks
+}
+
+// LocateHeaders is LocateBlocks for headers only
+func (bc *Blockchain) LocateHeaders(locator []string, stopHash string, max int) []*BlockHeader {
+	blocks := bc.LocateBlocks(locator, stopHash, max)
+	headers := make([]*BlockHeader, len(blocks))
+	for i, block := range blocks {
+		headers[i] = &block.BlockHeader
+	}
+	return headers
+}
+
+// locateFork returns the height of the first locator hash on the main chain
+func (bc *Blockchain) locateFork(locator []string) int {
+	for _, hash := range locator {
+		for height := len(bc.Chain) - 1; height >= 0; height-- {
+			if bc.Chain[height].Hash == hash {
+				return height
+			}
+		}
+	}
+	return 0
+}
+
+// CheckHeader runs the checks on a header that need no chain context, so that
+// headers received ahead of their blocks can be screened before downloading
+func (bc *Blockchain) CheckHeader(header *BlockHeader) error {
+	if header.Version < 1 {
+		return fmt.Errorf("unsupported block version %d", header.Version)
+	}
+	if header.Index < 1 {
+		return fmt.Errorf("invalid height %d", header.Index)
+	}
+	if header.Timestamp > time.Now().Add(2*time.Hour).Unix() {
+		return fmt.Errorf("timestamp %d is too far in the future", header.Timestamp)
+	}
+	if header.Miner == "" {
+		return fmt.Errorf("missing miner address")
+	}
+	return bc.checkProofOfWork(header)
+}
+
+// CheckHeaderChain screens a branch of headers received ahead of their
+// blocks. queued are headers screened earlier that the new headers extend;
+// the first of them, or of headers if none are queued, must have a known
+// parent block. Each new header must pass CheckHeader, follow its
+// predecessor and commit to the target of its own branch. It returns the
+// cumulative work of the branch up to the last header.
+func (bc *Blockchain) CheckHeaderChain(queued, headers []*BlockHeader) (*big.Int, error) {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	branch := append(append([]*BlockHeader(nil), queued...), headers...)
+	if len(branch) == 0 {
+		return nil, fmt.Errorf("no headers")
+	}
+
+	bc.syncIndex()
+	base, known := bc.blocks[branch[0].PrevHash]
+	if !known {
+		return nil, fmt.Errorf("headers do not connect to a known block")
+	}
+	ancestor := func(height int) *BlockHeader {
+		if first := branch[0].Index; height >= first {
+			return branch[height-first]
+		}
+		node := base
+		for node.block.Index > height {
+			node = node.parent
+		}
+		return &node.block.BlockHeader
+	}
+
+	work := new(big.Int).Set(base.work)
+	prev, prevHash := &base.block.BlockHeader, base.block.Hash
+	for i, header := range branch {
+		if i >= len(queued) {
+			if header.PrevHash != prevHash || header.Index != prev.Index+1 {
+				return nil, fmt.Errorf("header %d does not follow the previous header", header.Index)
+			}
+			if err := bc.CheckHeader(header); err != nil {
+				return nil, fmt.Errorf("header %d: %v", header.Index, err)
+			}
+			if expected := bc.bitsAfter(prev, ancestor); header.Bits != expected {
+				return nil, fmt.Errorf("header %d: target bits %#08x, expected %#08x", header.Index, header.Bits, expected)
+			}
+		}
+		work.Add(work, header.Work())
+		prev = header
+		if i >= len(queued)-1 {
+			prevHash = header.CalculateHash()
+		}
+	}
+	return work, nil
+}
+
+// checkProofOfWork verifies that the header meets its own target and that the
+// target is no easier than the proof-of-work limit
+func (bc *Blockchain) checkProofOfWork(header *BlockHeader) error {
+	if CompactToTarget(header.Bits).Cmp(CompactToTarget(bc.Retarget.PowLimitBits)) > 0 {
+		return fmt.Errorf("target bits %#08x are easier than the proof-of-work limit", header.Bits)
+	}
+	if !header.IsValid() {
+		return fmt.Errorf("insufficient proof of work")
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Domain separation prefixes keep leaf and interior hashes distinct, so an
+// interior node can never be passed off as a transaction (RFC 6962 style)
+const (
+	merkleLeafPrefix byte = 0x00
+	merkleNodePrefix byte = 0x01
+)
+
+// MerkleProof proves that a transaction is included under a Merkle root.
+// The leaf is the transaction's witness hash; the transaction hash only
+// identifies which transaction the proof is for. A verifier that only knows
+// the transaction hash must recompute the witness hash from the serialized
+// transaction before trusting the proof.
+type MerkleProof struct {
+	TxHash      string            `json:"tx_hash"`
+	WitnessHash string            `json:"witness_hash"`
+	Index       int               `json:"index"`
+	Root        string            `json:"root"`
+	Path        []MerkleProofStep `json:"path"`
+}
+
+// MerkleProofStep is one sibling hash on the path from leaf to root
+type MerkleProofStep struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"` // Sibling is the left child
+}
+
+// MerkleRoot computes the root of a binary Merkle tree over transaction
+// witness hashes. A node without a sibling is promoted unchanged to the next
+// level.
+func MerkleRoot(witnessHashes []string) string {
+	if len(witnessHashes) == 0 {
+		return ""
+	}
+
+	level := merkleLeaves(witnessHashes)
+	for len(level) > 1 {
+		level = merkleParentLevel(level)
+	}
+	return hex.EncodeToString(level[0])
+}
+
+// BuildMerkleProof builds the inclusion proof for the transaction at index
+func BuildMerkleProof(witnessHashes []string, index int) (*MerkleProof, error) {
+	if index < 0 || index >= len(witnessHashes) {
+		return nil, fmt.Errorf("transaction index %d out of range", index)
+	}
+
+	proof := &MerkleProof{
+		WitnessHash: witnessHashes[index],
+		Index:       index,
+	}
+
+	level := merkleLeaves(witnessHashes)
+	position := index
+	for len(level) > 1 {
+		sibling := position ^ 1
+		if sibling < len(level) {
+			proof.Path = append(proof.Path, MerkleProofStep{
+				Hash: hex.EncodeToString(level[sibling]),
+				Left: sibling < position,
+			})
+		}
+		level = merkleParentLevel(level)
+		position /= 2
+	}
+
+	proof.Root = hex.EncodeToString(level[0])
+	return proof, nil
+}
+
+// VerifyMerkleProof checks that a proof links its witness hash to its root
+func VerifyMerkleProof(proof *MerkleProof) bool {
+	if proof == nil || proof.Root == "" {
+		return false
+	}
+
+	hash := merkleLeafHash(proof.WitnessHash)
+	for _, step := range proof.Path {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil || len(sibling) != sha256.Size {
+			return false
+		}
+		if step.Left {
+			hash = merkleNodeHash(sibling, hash)
+		} else {
+			hash = merkleNodeHash(hash, sibling)
+		}
+	}
+
+	return hex.EncodeToString(hash) == proof.Root
+}
+
+func merkleLeaves(witnessHashes []string) [][]byte {
+	leaves := make([][]byte, len(witnessHashes))
+	for i, witnessHash := range witnessHashes {
+		leaves[i] = merkleLeafHash(witnessHash)
+	}
+	return leaves
+}
+
+func merkleParentLevel(level [][]byte) [][]byte {
+	parents := make([][]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			parents = append(parents, level[i])
+			continue
+		}
+		parents = append(parents, merkleNodeHash(level[i], level[i+1]))
+	}
+	return parents
+}
+
+func merkleLeafHash(witnessHash string) []byte {
+	data, err := hex.DecodeString(witnessHash)
+	if err != nil {
+		// Non-hex identifiers are hashed as text
+		data = []byte(witnessHash)
+	}
+
+	hash := sha256.Sum256(append([]byte{merkleLeafPrefix}, data...))
+	return hash[:]
+}
+
+func merkleNodeHash(left, right []byte) []byte {
+	data := make([]byte, 0, 1+len(left)+len(right))
+	data = append(data, merkleNodePrefix)
+	data = append(data, left...)
+	data = append(data, right...)
+
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
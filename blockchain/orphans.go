@@ -0,0 +1,150 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Limits of the orphan block pool
+const (
+	maxOrphanBlocks = 100
+	maxOrphanAge    = 10 * time.Minute
+)
+
+// ErrOrphanBlock is returned when a block's parent is not known yet.
+// The block is kept in the orphan pool until its parent arrives.
+var ErrOrphanBlock = errors.New("orphan block")
+
+// ErrKnownBlock is returned when a block was already added
+var ErrKnownBlock = errors.New("block already known")
+
+// orphanBlock is a block waiting in the pool for its parent
+type orphanBlock struct {
+	block    *Block
+	received time.Time
+}
+
+// orphanPool holds blocks that arrived before their parent, indexed both by
+// their own hash and by the hash of the parent they wait for
+type orphanPool struct {
+	byHash   map[string]*orphanBlock
+	byParent map[string][]*orphanBlock
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{
+		byHash:   make(map[string]*orphanBlock),
+		byParent: make(map[string][]*orphanBlock),
+	}
+}
+
+// add stores a block, first dropping expired orphans and then the oldest
+// ones if the pool is full
+func (p *orphanPool) add(block *Block) {
+	now := time.Now()
+	for _, orphan := range p.byHash {
+		if now.Sub(orphan.received) > maxOrphanAge {
+			p.remove(orphan.block.Hash)
+		}
+	}
+	for len(p.byHash) >= maxOrphanBlocks {
+		var oldest *orphanBlock
+		for _, orphan := range p.byHash {
+			if oldest == nil || orphan.received.Before(oldest.received) {
+				oldest = orphan
+			}
+		}
+		p.remove(oldest.block.Hash)
+	}
+
+	orphan := &orphanBlock{block: block, received: now}
+	p.byHash[block.Hash] = orphan
+	p.byParent[block.PrevHash] = append(p.byParent[block.PrevHash], orphan)
+}
+
+// remove deletes a block from the pool
+func (p *orphanPool) remove(hash string) {
+	orphan, exists := p.byHash[hash]
+	if !exists {
+		return
+	}
+	delete(p.byHash, hash)
+
+	siblings := p.byParent[orphan.block.PrevHash]
+	for i, sibling := range siblings {
+		if sibling == orphan {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(p.byParent, orphan.block.PrevHash)
+	} else {
+		p.byParent[orphan.block.PrevHash] = siblings
+	}
+}
+
+// addOrphan stores a block whose parent is unknown after checking that it
+// carries valid proof of work, so that the pool cannot be filled for free
+func (bc *Blockchain) addOrphan(block *Block) error {
+	if _, exists := bc.orphans.byHash[block.Hash]; exists {
+		return fmt.Errorf("%w: block %s already in orphan pool", ErrOrphanBlock, block.Hash)
+	}
+	if block.Hash != block.CalculateHash() {
+		return fmt.Errorf("block hash does not match its header")
+	}
+	if err := bc.checkProofOfWork(&block.BlockHeader); err != nil {
+		return err
+	}
+
+	bc.orphans.add(block)
+	fmt.Printf("👶 Stored orphan block %d (%s), waiting for parent %s\n",
+		block.Index, block.Hash[:16], block.PrevHash[:min(16, len(block.PrevHash))])
+	return fmt.Errorf("%w: parent %s unknown", ErrOrphanBlock, block.PrevHash)
+}
+
+// connectOrphans adds every orphan descending from the given block,
+// continuing with their own children as they are connected
+func (bc *Blockchain) connectOrphans(hash string) {
+	queue := []string{hash}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+
+		children := append([]*orphanBlock(nil), bc.orphans.byParent[parent]...)
+		for _, orphan := range children {
+			bc.orphans.remove(orphan.block.Hash)
+			if err := bc.addBlock(orphan.block); err != nil {
+				fmt.Printf("❌ Orphan block %d rejected: %v\n", orphan.block.Index, err)
+				continue
+			}
+			fmt.Printf("🔗 Connected orphan block %d (%s)\n", orphan.block.Index, orphan.block.Hash[:16])
+			queue = append(queue, orphan.block.Hash)
+		}
+	}
+}
+
+// GetOrphanRoot returns the hash of the missing ancestor of an orphan block,
+// which is the block to request from peers
+func (bc *Blockchain) GetOrphanRoot(hash string) string {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	root := hash
+	for {
+		orphan, exists := bc.orphans.byHash[root]
+		if !exists {
+			return root
+		}
+		root = orphan.block.PrevHash
+	}
+}
+
+// GetOrphanCount returns the number of blocks waiting for their parent
+func (bc *Blockchain) GetOrphanCount() int {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	return len(bc.orphans.byHash)
+}
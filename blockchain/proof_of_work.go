@@ -1,51 +1,130 @@
 package blockchain
 
-import "fmt"
+import (
+    "context"
+    "fmt"
+    "math/big"
+    "runtime"
+    "sync"
+    "sync/atomic"
+    "time"
+)
 
 // ProofOfWork implements the mining algorithm for AetherChain
 type ProofOfWork struct {
-    Block     *Block
-    Difficulty int
+    Block   *Block
+    Target  *big.Int
+    Workers int // Number of goroutines searching the nonce space
+
+    hashes atomic.Uint64
 }
 
-// NewProofOfWork creates a new ProofOfWork instance
-func NewProofOfWork(block *Block, difficulty int) *ProofOfWork {
+// NewProofOfWork creates a new ProofOfWork instance for a compact target,
+// mining on every available CPU core
+func NewProofOfWork(block *Block, bits uint32) *ProofOfWork {
     return &ProofOfWork{
-        Block:     block,
-        Difficulty: difficulty,
+        Block:   block,
+        Target:  CompactToTarget(bits),
+        Workers: runtime.NumCPU(),
     }
 }
 
 // Mine attempts to find a valid nonce for the block
 func (pow *ProofOfWork) Mine() (int64, string, error) {
-    var nonce int64 = 0
-    var hash string
-    
-    fmt.Printf("Mining block %d with difficulty %d...\n", pow.Block.Index, pow.Difficulty)
-    
-    for nonce < MaxNonce {
-        pow.Block.Nonce = nonce
-        hash = pow.Block.CalculateHash()
-        
-        if pow.IsValidHash(hash) {
+    return pow.MineContext(context.Background())
+}
+
+// MineContext searches for a valid nonce until one is found or ctx is done.
+// Each round splits the nonce space across the workers; when a round is
+// exhausted the block timestamp is rolled forward, or the extra nonce is
+// incremented if the clock has not advanced, and the search starts again.
+// The block's Nonce, Timestamp and ExtraNonce hold the solution on success.
+func (pow *ProofOfWork) MineContext(ctx context.Context) (int64, string, error) {
+    workers := pow.Workers
+    if workers < 1 {
+        workers = 1
+    }
+
+    fmt.Printf("Mining block %d with target %064x on %d workers...\n", pow.Block.Index, pow.Target, workers)
+
+    for {
+        nonce, hash, found := pow.searchNonces(ctx, pow.Block.BlockHeader, workers)
+        if found {
+            pow.Block.Nonce = nonce
             fmt.Printf("Block mined! Nonce: %d, Hash: %s\n", nonce, hash)
             return nonce, hash, nil
         }
-        
-        nonce++
+        if err := ctx.Err(); err != nil {
+            return 0, "", err
+        }
+
+        // Nonce space exhausted, change the header and search again
+        if now := time.Now().Unix(); now > pow.Block.Timestamp {
+            pow.Block.Timestamp = now
+        } else {
+            pow.Block.ExtraNonce++
+        }
+    }
+}
+
+// searchNonces tries every nonce below MaxNonce for the header, with worker i
+// checking nonces i, i+workers, i+2*workers and so on
+func (pow *ProofOfWork) searchNonces(ctx context.Context, header BlockHeader, workers int) (int64, string, bool) {
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    type solution struct {
+        nonce int64
+        hash  string
+    }
+    solutions := make(chan solution, workers)
+
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func(candidate BlockHeader, start int64) {
+            defer wg.Done()
+
+            for nonce, i := start, 0; nonce < MaxNonce; nonce, i = nonce+int64(workers), i+1 {
+                if i%cancelCheckInterval == 0 && ctx.Err() != nil {
+                    return
+                }
+
+                candidate.Nonce = nonce
+                hash := candidate.CalculateHash()
+                pow.hashes.Add(1)
+
+                if pow.IsValidHash(hash) {
+                    solutions <- solution{nonce: nonce, hash: hash}
+                    cancel()
+                    return
+                }
+            }
+        }(header, int64(w))
     }
-    
-    return 0, "", fmt.Errorf("failed to mine block after %d attempts", MaxNonce)
+    wg.Wait()
+
+    select {
+    case s := <-solutions:
+        return s.nonce, s.hash, true
+    default:
+        return 0, "", false
+    }
+}
+
+// Hashes returns the number of hashes computed so far
+func (pow *ProofOfWork) Hashes() uint64 {
+    return pow.hashes.Load()
 }
 
-// IsValidHash checks if a hash meets the difficulty requirement
+// IsValidHash checks if a hash, read as a 256-bit integer, does not exceed the target
 func (pow *ProofOfWork) IsValidHash(hash string) bool {
-    prefix := ""
-    for i := 0; i < pow.Difficulty; i++ {
-        prefix += "0"
+    value, ok := HashToBig(hash)
+    if !ok || pow.Target.Sign() <= 0 {
+        return false
     }
-    
-    return len(hash) >= pow.Difficulty && hash[:pow.Difficulty] == prefix
+
+    return value.Cmp(pow.Target) <= 0
 }
 
 // Validate checks if a block's hash is valid
@@ -54,5 +133,8 @@ func (pow *ProofOfWork) Validate() bool {
     return pow.IsValidHash(hash)
 }
 
-// MaxNonce defines the maximum mining attempts before giving up
-const MaxNonce = 100000000
\ No newline at end of file
+// MaxNonce bounds the nonces searched before the timestamp or extra nonce is rolled
+const MaxNonce = 100000000
+
+// cancelCheckInterval is how many hashes a worker computes between cancellation checks
+const cancelCheckInterval = 1024
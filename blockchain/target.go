@@ -0,0 +1,110 @@
+package blockchain
+
+import (
+	"math/big"
+)
+
+// oneLsh256 is 2^256, used to convert targets into expected work
+var oneLsh256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// CompactToTarget expands a compact "nBits" value into a 256-bit target.
+// The top byte is the target length in bytes and the low 23 bits are its
+// most significant digits. Negative encodings yield a zero target.
+func CompactToTarget(bits uint32) *big.Int {
+	exponent := uint(bits >> 24)
+	mantissa := bits & 0x007fffff
+	if bits&0x00800000 != 0 {
+		return new(big.Int)
+	}
+
+	if exponent <= 3 {
+		return big.NewInt(int64(mantissa >> (8 * (3 - exponent))))
+	}
+	target := big.NewInt(int64(mantissa))
+	return target.Lsh(target, 8*(exponent-3))
+}
+
+// TargetToCompact encodes a target in compact form, truncating it to
+// its three most significant bytes
+func TargetToCompact(target *big.Int) uint32 {
+	if target.Sign() <= 0 {
+		return 0
+	}
+
+	exponent := uint(len(target.Bytes()))
+	var mantissa uint32
+	if exponent <= 3 {
+		mantissa = uint32(target.Uint64()) << (8 * (3 - exponent))
+	} else {
+		shifted := new(big.Int).Rsh(target, 8*(exponent-3))
+		mantissa = uint32(shifted.Uint64())
+	}
+
+	// Keep the sign bit clear by moving to a longer encoding
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+	return uint32(exponent<<24) | mantissa
+}
+
+// HashToBig interprets a hex-encoded hash as a big-endian integer
+func HashToBig(hash string) (*big.Int, bool) {
+	return new(big.Int).SetString(hash, 16)
+}
+
+// WorkForBits returns the expected number of hashes needed to meet the target,
+// 2^256 / (target + 1)
+func WorkForBits(bits uint32) *big.Int {
+	target := CompactToTarget(bits)
+	if target.Sign() <= 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Div(oneLsh256, target.Add(target, big.NewInt(1)))
+}
+
+// Difficulty returns how many times harder the target is than the limit
+func Difficulty(bits, limitBits uint32) float64 {
+	target := CompactToTarget(bits)
+	if target.Sign() <= 0 {
+		return 0
+	}
+	ratio := new(big.Float).Quo(new(big.Float).SetInt(CompactToTarget(limitBits)), new(big.Float).SetInt(target))
+	difficulty, _ := ratio.Float64()
+	return difficulty
+}
+
+// Target returns the 256-bit target the header hash must not exceed
+func (h *BlockHeader) Target() *big.Int {
+	return CompactToTarget(h.Bits)
+}
+
+// Work returns the expected work represented by the header's target
+func (h *BlockHeader) Work() *big.Int {
+	return WorkForBits(h.Bits)
+}
+
+// ChainWork returns the cumulative work of the chain up to and including height
+func (bc *Blockchain) ChainWork(height int) *big.Int {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	return bc.chainWork(height)
+}
+
+// TipWork returns the cumulative work of the main chain
+func (bc *Blockchain) TipWork() *big.Int {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	bc.syncIndex()
+	return new(big.Int).Set(bc.blocks[bc.Chain[len(bc.Chain)-1].Hash].work)
+}
+
+func (bc *Blockchain) chainWork(height int) *big.Int {
+	work := new(big.Int)
+	for i := 0; i <= height && i < len(bc.Chain); i++ {
+		work.Add(work, bc.Chain[i].Work())
+	}
+	return work
+}
@@ -3,8 +3,10 @@ package blockchain
 import (
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
+	"fmt"
 	"time"
+
+	"aetherchain/crypto"
 )
 
 // Transaction represents a value transfer in AetherChain
@@ -13,8 +15,8 @@ type Transaction struct {
     Hash     string  `json:"hash"`      // Transaction hash (ID)
     From     string  `json:"from"`      // Sender's address
     To       string  `json:"to"`        // Recipient's address
-    Amount   float64 `json:"amount"`    // Amount being transferred
-    Fee      float64 `json:"fee"`       // Transaction fee
+    Amount   Amount  `json:"amount"`    // Amount being transferred
+    Fee      Amount  `json:"fee"`       // Transaction fee
     Nonce    int64   `json:"nonce"`     // Prevents replay attacks
     Timestamp int64  `json:"timestamp"` // When transaction was created
     
@@ -27,8 +29,11 @@ type Transaction struct {
     BlockHash string `json:"block_hash"` // Hash of containing block
 }
 
+// CoinbaseAddress is the sender of coinbase and genesis transactions, which mint new coins
+const CoinbaseAddress = "0"
+
 // NewTransaction creates a new transaction
-func NewTransaction(from, to string, amount, fee float64, nonce int64) *Transaction {
+func NewTransaction(from, to string, amount, fee Amount, nonce int64) *Transaction {
     tx := &Transaction{
         Version:   1,
         From:      from,
@@ -44,59 +49,123 @@ func NewTransaction(from, to string, amount, fee float64, nonce int64) *Transact
     return tx
 }
 
-// CalculateHash computes the transaction hash
+// CalculateHash computes the transaction hash over its canonical binary encoding
 func (tx *Transaction) CalculateHash() string {
-    hashData := struct {
-        Version   int     `json:"version"`
-        From      string  `json:"from"`
-        To        string  `json:"to"`
-        Amount    float64 `json:"amount"`
-        Fee       float64 `json:"fee"`
-        Nonce     int64   `json:"nonce"`
-        Timestamp int64   `json:"timestamp"`
-    }{
-        Version:   tx.Version,
-        From:      tx.From,
-        To:        tx.To,
-        Amount:    tx.Amount,
-        Fee:       tx.Fee,
-        Nonce:     tx.Nonce,
-        Timestamp: tx.Timestamp,
-    }
-    
-    data, _ := json.Marshal(hashData)
+    hash := sha256.Sum256(tx.signingBytes())
+    return hex.EncodeToString(hash[:])
+}
+
+// WitnessHash computes the hash of the full binary encoding, including the
+// public key and signature that the transaction hash leaves out. Blocks
+// commit to witness hashes in their Merkle root, so a block's transactions
+// cannot have their signatures replaced without changing the block hash.
+func (tx *Transaction) WitnessHash() string {
+    data, _ := tx.MarshalBinary()
     hash := sha256.Sum256(data)
     return hex.EncodeToString(hash[:])
 }
 
-// Sign creates a digital signature for the transaction
-func (tx *Transaction) Sign(privateKey string) error {
-    // In production, this would use proper cryptographic signing
-    // For now, we'll create a simple signature
-    signatureData := tx.Hash + privateKey
-    hash := sha256.Sum256([]byte(signatureData))
-    tx.Signature = hex.EncodeToString(hash[:])
+// NewCoinbaseTransaction creates the coinbase transaction of the block at the
+// given height, paying value to the miner. The height is used as the nonce so
+// that every coinbase has a distinct hash.
+func NewCoinbaseTransaction(miner string, height int, value Amount) *Transaction {
+    tx := &Transaction{
+        Version:   1,
+        From:      CoinbaseAddress,
+        To:        miner,
+        Amount:    value,
+        Nonce:     int64(height),
+        Timestamp: time.Now().Unix(),
+        Status:    "pending",
+    }
+    
+    tx.Hash = tx.CalculateHash()
+    return tx
+}
+
+// IsCoinbase reports whether the transaction mints coins instead of spending them
+func (tx *Transaction) IsCoinbase() bool {
+    return tx.From == CoinbaseAddress
+}
+
+// Sign signs the transaction hash with the sender's key pair.
+// The key must belong to the From address; its public key is attached to the
+// transaction so that any node can verify ownership of the funds.
+func (tx *Transaction) Sign(keyPair *crypto.KeyPair) error {
+    if keyPair == nil || keyPair.PrivateKey == nil {
+        return fmt.Errorf("missing private key")
+    }
+
+    // The signing key must own the sender address
+    address, err := crypto.AddressFromPublicKey(keyPair.PublicKey)
+    if err != nil {
+        return err
+    }
+    if address != tx.From {
+        return fmt.Errorf("private key does not match sender address %s", tx.From)
+    }
+
+    encodedKey, err := crypto.EncodePublicKey(keyPair.PublicKey)
+    if err != nil {
+        return err
+    }
+    tx.PublicKey = encodedKey
+
+    // Always sign the hash of the current contents
+    tx.Hash = tx.CalculateHash()
+    hashBytes, err := hex.DecodeString(tx.Hash)
+    if err != nil {
+        return err
+    }
+
+    signature, err := crypto.Sign(hashBytes, keyPair.PrivateKey)
+    if err != nil {
+        return err
+    }
+    tx.Signature = signature
     return nil
 }
 
-// VerifySignature checks if the transaction signature is valid
+// VerifySignature checks that the transaction is signed by the owner of the From address
 func (tx *Transaction) VerifySignature() bool {
-    if tx.Signature == "" {
+    if tx.Signature == "" || tx.PublicKey == "" {
         return false
     }
-    
-    // In production, this would verify the cryptographic signature
-    // For demonstration, we'll use a simple check
-    expectedSignature := tx.Hash + tx.PublicKey
-    hash := sha256.Sum256([]byte(expectedSignature))
-    expectedHash := hex.EncodeToString(hash[:])
-    
-    return tx.Signature == expectedHash
+
+    // The hash must commit to the transaction contents
+    if tx.Hash != tx.CalculateHash() {
+        return false
+    }
+
+    // The key encoding identifies the signature algorithm
+    publicKey, err := crypto.DecodePublicKey(tx.PublicKey)
+    if err != nil {
+        return false
+    }
+
+    // From must be derived from the attached public key
+    address, err := crypto.AddressFromPublicKey(publicKey)
+    if err != nil || address != tx.From {
+        return false
+    }
+
+    hashBytes, err := hex.DecodeString(tx.Hash)
+    if err != nil {
+        return false
+    }
+
+    return crypto.Verify(hashBytes, tx.Signature, publicKey)
 }
 
-// IsValid performs basic validation checks on the transaction
+// IsValid performs basic validation checks on the transaction.
+// Coinbase transactions are never valid on their own since they carry no
+// signature; they are checked as part of their block.
 func (tx *Transaction) IsValid() bool {
-    if tx.Amount <= 0 {
+    if tx.Amount == 0 {
+        return false
+    }
+    
+    if _, err := tx.Amount.Add(tx.Fee); err != nil {
         return false
     }
     
@@ -111,17 +180,17 @@ func (tx *Transaction) IsValid() bool {
     return true
 }
 
-// Serialize converts the transaction to JSON bytes
+// Serialize converts the transaction to its canonical binary encoding
 func (tx *Transaction) Serialize() ([]byte, error) {
-    return json.Marshal(tx)
+    return tx.MarshalBinary()
 }
 
-// DeserializeTransaction creates a Transaction from JSON bytes
+// DeserializeTransaction creates a Transaction from its canonical binary encoding
 func DeserializeTransaction(data []byte) (*Transaction, error) {
     var tx Transaction
-    err := json.Unmarshal(data, &tx)
+    err := tx.UnmarshalBinary(data)
     if err != nil {
         return nil, err
     }
     return &tx, nil
-}
\ No newline at end of file
+}
@@ -18,11 +18,36 @@ type Config struct {
     Port          int           `json:"port"`
     BootstrapNodes []string     `json:"bootstrap_nodes"`
     PeerTimeout   time.Duration `json:"peer_timeout"`
+    TargetOutboundPeers int     `json:"target_outbound_peers"` // Outbound connections peer discovery keeps open
+    MaxOutboundPeers    int     `json:"max_outbound_peers"`    // Outbound connections, including persistent peers
+    MaxInboundPeers     int     `json:"max_inbound_peers"`
+    P2PEncryption        bool `json:"p2p_encryption"`         // Offer encrypted, authenticated transport to peers
+    P2PRequireEncryption bool `json:"p2p_require_encryption"` // Refuse peers that do not encrypt
+    P2PIdentityPassphrase string `json:"p2p_identity_passphrase"` // Encrypts the stored node identity, none is stored if empty; required with pinned bootstrap nodes
+    P2PAllowPrivateAddresses bool `json:"p2p_allow_private_addresses"` // Accept loopback, private and link-local addresses from any peer
+    
+    // Peer Protection Configuration
+    BanThreshold      int           `json:"ban_threshold"`        // Misbehavior score at which a peer is banned
+    BanDuration       time.Duration `json:"ban_duration"`
+    MaxMessageRate    float64       `json:"max_message_rate"`     // Messages per second a peer may send on average
+    MaxMessageBurst   int           `json:"max_message_burst"`    // Messages a peer may send at once
+    MaxPeersPerIP     int           `json:"max_peers_per_ip"`     // Inbound connections per IP address
+    MaxPeersPerSubnet int           `json:"max_peers_per_subnet"` // Inbound connections per /24 IPv4 or /64 IPv6 subnet
     
     // Blockchain Configuration
-    GenesisBlockHash string  `json:"genesis_block_hash"`
-    BlockReward      float64 `json:"block_reward"`
-    Difficulty       int     `json:"difficulty"`
+    GenesisBlockHash string        `json:"genesis_block_hash"`
+    BlockReward      float64       `json:"block_reward"`      // Initial subsidy in whole coins
+    HalvingInterval  int           `json:"halving_interval"`  // Blocks between subsidy halvings, 0 disables halving
+    TailEmission     float64       `json:"tail_emission"`     // Minimum subsidy in whole coins
+    MaxSupply        float64       `json:"max_supply"`        // Cap on mined coins in whole coins, 0 for no cap
+    GenesisBits      uint32        `json:"genesis_bits"`      // Compact proof-of-work target of the genesis block
+    PowLimitBits     uint32        `json:"pow_limit_bits"`    // Easiest compact target retargeting may reach
+    TargetBlockTime  time.Duration `json:"target_block_time"` // Desired time between blocks
+    RetargetInterval int           `json:"retarget_interval"` // Blocks between difficulty adjustments, 0 disables them
+    
+    // Denomination Configuration
+    CoinSymbol   string `json:"coin_symbol"`
+    CoinDecimals int    `json:"coin_decimals"` // Base-unit digits after the decimal point
     
     // Storage Configuration
     DataDirectory string `json:"data_directory"`
@@ -43,9 +68,28 @@ func DefaultConfig() *Config {
         Port:            30303,
         BootstrapNodes:  []string{},
         PeerTimeout:     30 * time.Second,
+        TargetOutboundPeers: 8,
+        MaxOutboundPeers: 16,
+        MaxInboundPeers: 64,
+        P2PEncryption:   true,
+        P2PRequireEncryption: false,
+        BanThreshold:    100,
+        BanDuration:     24 * time.Hour,
+        MaxMessageRate:  50,
+        MaxMessageBurst: 500,
+        MaxPeersPerIP:   2,
+        MaxPeersPerSubnet: 8,
         GenesisBlockHash: "aether_genesis_2024",
         BlockReward:     50.0,
-        Difficulty:      4, // Number of leading zeros required in hash
+        HalvingInterval: 210000,
+        TailEmission:    0,
+        MaxSupply:       21000000,
+        GenesisBits:     0x1f00ffff, // Roughly 16 leading zero bits, like four leading hex zeros
+        PowLimitBits:    0x2000ffff,
+        TargetBlockTime: 30 * time.Second,
+        RetargetInterval: 20,
+        CoinSymbol:      "AETH",
+        CoinDecimals:    8,
         DataDirectory:   "./data",
         APIEnabled:      true,
         APIHost:         "127.0.0.1",
@@ -1,7 +1,9 @@
 package consensus
 
 import (
+	"context"
 	"fmt"
+	"runtime"
 	"sync"
 	"time"
 
@@ -16,15 +18,37 @@ type Consensus struct {
 	isMining   bool
 	miningStop chan bool
 	mutex      sync.RWMutex
+
+	// Current mining attempt
+	minerAddress string
+	workers      int
+	pow          *blockchain.ProofOfWork
+	powStarted   time.Time
+	cancelPow    context.CancelFunc
+	hashRate     float64 // Hashes per second of the last finished attempt
 }
 
 // NewConsensus creates a new consensus instance
 func NewConsensus(bc *blockchain.Blockchain, node *network.Node) *Consensus {
-	return &Consensus{
+	c := &Consensus{
 		blockchain: bc,
 		node:       node,
 		miningStop: make(chan bool),
+		workers:    runtime.NumCPU(),
 	}
+	bc.OnTipChanged(c.tipChanged)
+	return c
+}
+
+// SetMiningWorkers sets the number of goroutines used for mining
+func (c *Consensus) SetMiningWorkers(workers int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if workers < 1 {
+		workers = 1
+	}
+	c.workers = workers
 }
 
 // StartMining begins the mining process
@@ -37,6 +61,7 @@ func (c *Consensus) StartMining(minerAddress string) error {
 	}
 
 	c.isMining = true
+	c.minerAddress = minerAddress
 	fmt.Printf("⛏️ Starting mining with address: %s\n", minerAddress)
 
 	// Start mining in a separate goroutine
@@ -45,15 +70,42 @@ func (c *Consensus) StartMining(minerAddress string) error {
 	return nil
 }
 
-// StopMining stops the mining process
+// StopMining stops the mining process, aborting the current attempt
 func (c *Consensus) StopMining() {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	if !c.isMining {
+		c.mutex.Unlock()
+		return
+	}
+	c.isMining = false
+	c.mutex.Unlock()
 
-	if c.isMining {
-		c.miningStop <- true
-		c.isMining = false
-		fmt.Println("⛏️ Mining stopped")
+	c.abortMining()
+	c.miningStop <- true
+	fmt.Println("⛏️ Mining stopped")
+}
+
+// abortMining cancels the block currently being mined, if any
+func (c *Consensus) abortMining() {
+	c.mutex.RLock()
+	cancel := c.cancelPow
+	c.mutex.RUnlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// tipChanged abandons the block being mined once it no longer extends the
+// tip, whether the tip moved through a received block or a reorganization
+func (c *Consensus) tipChanged(tip *blockchain.Block) {
+	c.mutex.RLock()
+	stale := c.pow != nil && c.pow.Block.PrevHash != tip.Hash
+	c.mutex.RUnlock()
+
+	if stale {
+		fmt.Printf("⏸️ New tip %d, abandoning the block being mined...\n", tip.Index)
+		c.abortMining()
 	}
 }
 
@@ -68,7 +120,7 @@ func (c *Consensus) miningLoop(minerAddress string) {
 			return
 		case <-miningTicker.C:
 			// Only mine if there are pending transactions
-			if len(c.blockchain.TransactionPool) > 0 {
+			if c.blockchain.GetPendingTransactionCount() > 0 {
 				c.mineBlock(minerAddress)
 			} else {
 				fmt.Println("⏳ No transactions to mine, waiting...")
@@ -80,18 +132,51 @@ func (c *Consensus) miningLoop(minerAddress string) {
 // mineBlock attempts to mine a new block
 func (c *Consensus) mineBlock(minerAddress string) {
 	fmt.Printf("⛏️ Attempting to mine new block with %d pending transactions...\n", 
-		len(c.blockchain.TransactionPool))
+		c.blockchain.GetPendingTransactionCount())
 
-	// Create and mine new block
-	block, err := c.blockchain.CreateNewBlock(minerAddress)
+	// Build a block on the current tip
+	block, err := c.blockchain.NewBlockTemplate(minerAddress)
 	if err != nil {
 		fmt.Printf("❌ Mining failed: %v\n", err)
 		return
 	}
 
+	// Mine it until solved or a new tip arrives
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c.mutex.Lock()
+	pow := blockchain.NewProofOfWork(block, block.Bits)
+	pow.Workers = c.workers
+	c.pow = pow
+	c.powStarted = time.Now()
+	c.cancelPow = cancel
+	c.mutex.Unlock()
+
+	// The tip may have moved before the attempt was registered for tipChanged
+	if c.blockchain.GetLastBlock().Hash != block.PrevHash {
+		cancel()
+	}
+
+	_, hash, err := pow.MineContext(ctx)
+
+	c.mutex.Lock()
+	if elapsed := time.Since(c.powStarted).Seconds(); elapsed > 0 {
+		c.hashRate = float64(pow.Hashes()) / elapsed
+	}
+	c.pow = nil
+	c.cancelPow = nil
+	c.mutex.Unlock()
+
+	if err != nil {
+		fmt.Printf("⏹️ Mining of block %d aborted: %v\n", block.Index, err)
+		return
+	}
+	block.Hash = hash
+
 	fmt.Printf("✅ Successfully mined block %d\n", block.Index)
 	fmt.Printf("📦 Block hash: %s\n", block.Hash)
-	fmt.Printf("💰 Miner reward: %.2f\n", block.BlockReward)
+	fmt.Printf("💰 Miner reward: %s\n", block.Coinbase().Amount)
 
 	// Add block to blockchain
 	if err := c.blockchain.AddBlock(block); err != nil {
@@ -103,13 +188,12 @@ func (c *Consensus) mineBlock(minerAddress string) {
 	c.broadcastNewBlock(block)
 }
 
-// broadcastNewBlock broadcasts a newly mined block to the network
+// broadcastNewBlock announces a newly mined block to the network
 func (c *Consensus) broadcastNewBlock(block *blockchain.Block) {
-	// In a real implementation, this would use the network layer to broadcast
-	// For now, we'll just log the action
 	fmt.Printf("📢 Broadcasting new block %d to network\n", block.Index)
-	
-	// This would typically use: c.node.BroadcastNewBlock(block)
+	if c.node != nil {
+		c.node.RelayBlock(block)
+	}
 }
 
 // IsMining returns whether the node is currently mining
@@ -122,14 +206,25 @@ func (c *Consensus) IsMining() bool {
 // GetMiningStatus returns detailed mining status
 func (c *Consensus) GetMiningStatus() map[string]interface{} {
 	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+	hashRate := c.hashRate
+	if c.pow != nil {
+		if elapsed := time.Since(c.powStarted).Seconds(); elapsed > 0 {
+			hashRate = float64(c.pow.Hashes()) / elapsed
+		}
+	}
+	isMining, minerAddress, workers := c.isMining, c.minerAddress, c.workers
+	c.mutex.RUnlock()
 
+	// Chain state is read through the blockchain's locked accessors
 	return map[string]interface{}{
-		"is_mining":          c.isMining,
-		"miner_address":      "default_miner", // This would track the actual miner
-		"pending_transactions": len(c.blockchain.TransactionPool),
-		"difficulty":         c.blockchain.Difficulty,
-		"block_reward":       c.blockchain.BlockReward,
+		"is_mining":            isMining,
+		"miner_address":        minerAddress,
+		"workers":              workers,
+		"hash_rate":            hashRate, // Hashes per second
+		"pending_transactions": c.blockchain.GetPendingTransactionCount(),
+		"difficulty":           c.blockchain.GetNextDifficulty(),
+		"bits":                 c.blockchain.GetNextBits(),
+		"block_reward":         c.blockchain.GetBlockReward(c.blockchain.GetLastBlock().Index + 1),
 	}
 }
 
@@ -154,14 +249,23 @@ func (c *Consensus) ValidateBlock(block *blockchain.Block) bool {
 	}
 
 	// Validate proof of work
-	pow := blockchain.NewProofOfWork(block, c.blockchain.Difficulty)
+	expected, err := c.blockchain.ExpectedBits(block.Index)
+	if err != nil || block.Bits != expected {
+		fmt.Printf("❌ Block target bits %#08x do not match the expected target\n", block.Bits)
+		return false
+	}
+	pow := blockchain.NewProofOfWork(block, expected)
 	if !pow.Validate() {
 		fmt.Printf("❌ Block proof of work invalid\n")
 		return false
 	}
 
 	// Validate all transactions in the block
-	for _, tx := range block.Transactions {
+	if block.Coinbase() == nil {
+		fmt.Printf("❌ Block is missing its coinbase transaction\n")
+		return false
+	}
+	for _, tx := range block.Transactions[1:] {
 		if !tx.IsValid() {
 			fmt.Printf("❌ Block contains invalid transaction: %s\n", tx.Hash)
 			return false
@@ -176,8 +280,9 @@ func (c *Consensus) ValidateBlock(block *blockchain.Block) bool {
 func (c *Consensus) HandleReceivedBlock(block *blockchain.Block) {
 	fmt.Printf("📦 Received block %d from network\n", block.Index)
 
-	// Validate the block
-	if !c.ValidateBlock(block) {
+	// Blocks extending the tip get the full consensus checks here; blocks on
+	// other branches are validated by the chain when it reorganizes to them
+	if block.PrevHash == c.blockchain.GetLastBlock().Hash && !c.ValidateBlock(block) {
 		fmt.Printf("❌ Received block %d failed validation\n", block.Index)
 		return
 	}
@@ -188,11 +293,6 @@ func (c *Consensus) HandleReceivedBlock(block *blockchain.Block) {
 		return
 	}
 
+	// The block being mined is abandoned by tipChanged if the tip moved
 	fmt.Printf("✅ Successfully added received block %d to chain\n", block.Index)
-
-	// If we're mining, we might want to stop current mining attempt
-	// since a new block was added to the chain
-	if c.IsMining() {
-		fmt.Println("⏸️ New block received, mining may need to restart...")
-	}
 }
\ No newline at end of file
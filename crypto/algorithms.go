@@ -0,0 +1,251 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secp256k1ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// KeyAlgorithm identifies a supported public key algorithm
+type KeyAlgorithm string
+
+const (
+	AlgorithmRSA       KeyAlgorithm = "RSA"
+	AlgorithmECDSAP256 KeyAlgorithm = "ECDSA-P256"
+	AlgorithmSecp256k1 KeyAlgorithm = "SECP256K1"
+	AlgorithmEd25519   KeyAlgorithm = "ED25519"
+)
+
+// DefaultKeyAlgorithm is used when no algorithm is requested explicitly
+const DefaultKeyAlgorithm = AlgorithmEd25519
+
+// Algorithm implements key handling and signing for one key algorithm
+type Algorithm interface {
+	// Name returns the algorithm identifier
+	Name() KeyAlgorithm
+	// SignatureScheme describes the signature scheme, e.g. "RSA-SHA256"
+	SignatureScheme() string
+	// GenerateKey creates a new random private key
+	GenerateKey() (crypto.PrivateKey, error)
+	// PublicKey returns the public half of a private key
+	PublicKey(privateKey crypto.PrivateKey) crypto.PublicKey
+	// KeySize returns the key size in bits
+	KeySize(publicKey crypto.PublicKey) int
+	// MarshalPrivateKey encodes a private key as PKCS#8 DER
+	MarshalPrivateKey(privateKey crypto.PrivateKey) ([]byte, error)
+	// MarshalPublicKey encodes a public key as PKIX DER
+	MarshalPublicKey(publicKey crypto.PublicKey) ([]byte, error)
+	// Sign signs data with the private key
+	Sign(privateKey crypto.PrivateKey, data []byte) ([]byte, error)
+	// Verify checks a signature over data with the public key
+	Verify(publicKey crypto.PublicKey, data, signature []byte) bool
+}
+
+var algorithms = map[KeyAlgorithm]Algorithm{
+	AlgorithmRSA:       rsaAlgorithm{bits: 2048},
+	AlgorithmECDSAP256: ecdsaP256Algorithm{},
+	AlgorithmSecp256k1: secp256k1Algorithm{},
+	AlgorithmEd25519:   ed25519Algorithm{},
+}
+
+// GetAlgorithm returns the implementation of the named algorithm
+func GetAlgorithm(name KeyAlgorithm) (Algorithm, error) {
+	algorithm, exists := algorithms[KeyAlgorithm(strings.ToUpper(string(name)))]
+	if !exists {
+		return nil, fmt.Errorf("unsupported key algorithm: %s", name)
+	}
+	return algorithm, nil
+}
+
+// SupportedAlgorithms returns the names of all supported algorithms
+func SupportedAlgorithms() []KeyAlgorithm {
+	return []KeyAlgorithm{AlgorithmEd25519, AlgorithmSecp256k1, AlgorithmECDSAP256, AlgorithmRSA}
+}
+
+// AlgorithmOf returns the algorithm of a private or public key
+func AlgorithmOf(key interface{}) (Algorithm, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return algorithms[AlgorithmRSA], nil
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return algorithms[AlgorithmEd25519], nil
+	case *secp256k1.PrivateKey, *secp256k1.PublicKey:
+		return algorithms[AlgorithmSecp256k1], nil
+	case *ecdsa.PrivateKey:
+		if k.Curve == elliptic.P256() {
+			return algorithms[AlgorithmECDSAP256], nil
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve == elliptic.P256() {
+			return algorithms[AlgorithmECDSAP256], nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported key type: %T", key)
+}
+
+// rsaAlgorithm implements RSA PKCS#1 v1.5 signatures over SHA-256
+type rsaAlgorithm struct {
+	bits int
+}
+
+func (a rsaAlgorithm) Name() KeyAlgorithm      { return AlgorithmRSA }
+func (a rsaAlgorithm) SignatureScheme() string { return "RSA-SHA256" }
+
+func (a rsaAlgorithm) GenerateKey() (crypto.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, a.bits)
+}
+
+func (a rsaAlgorithm) PublicKey(privateKey crypto.PrivateKey) crypto.PublicKey {
+	return &privateKey.(*rsa.PrivateKey).PublicKey
+}
+
+func (a rsaAlgorithm) KeySize(publicKey crypto.PublicKey) int {
+	return publicKey.(*rsa.PublicKey).N.BitLen()
+}
+
+func (a rsaAlgorithm) MarshalPrivateKey(privateKey crypto.PrivateKey) ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(privateKey)
+}
+
+func (a rsaAlgorithm) MarshalPublicKey(publicKey crypto.PublicKey) ([]byte, error) {
+	return x509.MarshalPKIXPublicKey(publicKey)
+}
+
+func (a rsaAlgorithm) Sign(privateKey crypto.PrivateKey, data []byte) ([]byte, error) {
+	hashed := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, privateKey.(*rsa.PrivateKey), crypto.SHA256, hashed[:])
+}
+
+func (a rsaAlgorithm) Verify(publicKey crypto.PublicKey, data, signature []byte) bool {
+	hashed := sha256.Sum256(data)
+	return rsa.VerifyPKCS1v15(publicKey.(*rsa.PublicKey), crypto.SHA256, hashed[:], signature) == nil
+}
+
+// ecdsaP256Algorithm implements ECDSA on NIST P-256 over SHA-256
+type ecdsaP256Algorithm struct{}
+
+func (a ecdsaP256Algorithm) Name() KeyAlgorithm      { return AlgorithmECDSAP256 }
+func (a ecdsaP256Algorithm) SignatureScheme() string { return "ECDSA-P256-SHA256" }
+
+func (a ecdsaP256Algorithm) GenerateKey() (crypto.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+func (a ecdsaP256Algorithm) PublicKey(privateKey crypto.PrivateKey) crypto.PublicKey {
+	return &privateKey.(*ecdsa.PrivateKey).PublicKey
+}
+
+func (a ecdsaP256Algorithm) KeySize(publicKey crypto.PublicKey) int {
+	return 256
+}
+
+func (a ecdsaP256Algorithm) MarshalPrivateKey(privateKey crypto.PrivateKey) ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(privateKey)
+}
+
+func (a ecdsaP256Algorithm) MarshalPublicKey(publicKey crypto.PublicKey) ([]byte, error) {
+	return x509.MarshalPKIXPublicKey(publicKey)
+}
+
+func (a ecdsaP256Algorithm) Sign(privateKey crypto.PrivateKey, data []byte) ([]byte, error) {
+	hashed := sha256.Sum256(data)
+	return ecdsa.SignASN1(rand.Reader, privateKey.(*ecdsa.PrivateKey), hashed[:])
+}
+
+func (a ecdsaP256Algorithm) Verify(publicKey crypto.PublicKey, data, signature []byte) bool {
+	hashed := sha256.Sum256(data)
+	return ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), hashed[:], signature)
+}
+
+// secp256k1Algorithm implements ECDSA on secp256k1 over SHA-256
+type secp256k1Algorithm struct{}
+
+func (a secp256k1Algorithm) Name() KeyAlgorithm      { return AlgorithmSecp256k1 }
+func (a secp256k1Algorithm) SignatureScheme() string { return "ECDSA-SECP256K1-SHA256" }
+
+func (a secp256k1Algorithm) GenerateKey() (crypto.PrivateKey, error) {
+	return secp256k1.GeneratePrivateKey()
+}
+
+func (a secp256k1Algorithm) PublicKey(privateKey crypto.PrivateKey) crypto.PublicKey {
+	return privateKey.(*secp256k1.PrivateKey).PubKey()
+}
+
+func (a secp256k1Algorithm) KeySize(publicKey crypto.PublicKey) int {
+	return 256
+}
+
+func (a secp256k1Algorithm) MarshalPrivateKey(privateKey crypto.PrivateKey) ([]byte, error) {
+	return marshalSecp256k1PrivateKey(privateKey.(*secp256k1.PrivateKey))
+}
+
+func (a secp256k1Algorithm) MarshalPublicKey(publicKey crypto.PublicKey) ([]byte, error) {
+	return marshalSecp256k1PublicKey(publicKey.(*secp256k1.PublicKey))
+}
+
+func (a secp256k1Algorithm) Sign(privateKey crypto.PrivateKey, data []byte) ([]byte, error) {
+	hashed := sha256.Sum256(data)
+	return secp256k1ecdsa.Sign(privateKey.(*secp256k1.PrivateKey), hashed[:]).Serialize(), nil
+}
+
+func (a secp256k1Algorithm) Verify(publicKey crypto.PublicKey, data, signature []byte) bool {
+	sig, err := secp256k1ecdsa.ParseDERSignature(signature)
+	if err != nil {
+		return false
+	}
+	hashed := sha256.Sum256(data)
+	return sig.Verify(hashed[:], publicKey.(*secp256k1.PublicKey))
+}
+
+// ed25519Algorithm implements Ed25519 signatures
+type ed25519Algorithm struct{}
+
+func (a ed25519Algorithm) Name() KeyAlgorithm      { return AlgorithmEd25519 }
+func (a ed25519Algorithm) SignatureScheme() string { return "ED25519" }
+
+func (a ed25519Algorithm) GenerateKey() (crypto.PrivateKey, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	return privateKey, err
+}
+
+func (a ed25519Algorithm) PublicKey(privateKey crypto.PrivateKey) crypto.PublicKey {
+	return privateKey.(ed25519.PrivateKey).Public()
+}
+
+func (a ed25519Algorithm) KeySize(publicKey crypto.PublicKey) int {
+	return 256
+}
+
+func (a ed25519Algorithm) MarshalPrivateKey(privateKey crypto.PrivateKey) ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(privateKey)
+}
+
+func (a ed25519Algorithm) MarshalPublicKey(publicKey crypto.PublicKey) ([]byte, error) {
+	return x509.MarshalPKIXPublicKey(publicKey)
+}
+
+func (a ed25519Algorithm) Sign(privateKey crypto.PrivateKey, data []byte) ([]byte, error) {
+	key := privateKey.(ed25519.PrivateKey)
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 private key length: %d", len(key))
+	}
+	return ed25519.Sign(key, data), nil
+}
+
+func (a ed25519Algorithm) Verify(publicKey crypto.PublicKey, data, signature []byte) bool {
+	key := publicKey.(ed25519.PublicKey)
+	if len(key) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(key, data, signature)
+}
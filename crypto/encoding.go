@@ -0,0 +1,157 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// The standard library cannot encode secp256k1 keys, so they are written in
+// the same PKIX/PKCS#8 containers other tools use (RFC 5480 / RFC 5915).
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidCurveSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+type pkixPublicKey struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+type pkcs8PrivateKey struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// MarshalPrivateKey encodes any supported private key as PKCS#8 DER
+func MarshalPrivateKey(privateKey crypto.PrivateKey) ([]byte, error) {
+	algorithm, err := AlgorithmOf(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return algorithm.MarshalPrivateKey(privateKey)
+}
+
+// ParsePrivateKey decodes a PKCS#8 DER private key of any supported algorithm
+func ParsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	var info pkcs8PrivateKey
+	if _, err := asn1.Unmarshal(der, &info); err == nil && isSecp256k1(info.Algorithm) {
+		return parseSecp256k1PrivateKey(info.PrivateKey)
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := AlgorithmOf(privateKey); err != nil {
+		return nil, err
+	}
+	return privateKey, nil
+}
+
+// MarshalPublicKey encodes any supported public key as PKIX DER
+func MarshalPublicKey(publicKey crypto.PublicKey) ([]byte, error) {
+	algorithm, err := AlgorithmOf(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return algorithm.MarshalPublicKey(publicKey)
+}
+
+// ParsePublicKey decodes a PKIX DER public key of any supported algorithm
+func ParsePublicKey(der []byte) (crypto.PublicKey, error) {
+	var info pkixPublicKey
+	if _, err := asn1.Unmarshal(der, &info); err == nil && isSecp256k1(info.Algorithm) {
+		return secp256k1.ParsePubKey(info.PublicKey.RightAlign())
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := AlgorithmOf(publicKey); err != nil {
+		return nil, err
+	}
+	return publicKey, nil
+}
+
+func isSecp256k1(algorithm pkix.AlgorithmIdentifier) bool {
+	if !algorithm.Algorithm.Equal(oidPublicKeyECDSA) {
+		return false
+	}
+	var curve asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &curve); err != nil {
+		return false
+	}
+	return curve.Equal(oidCurveSecp256k1)
+}
+
+func secp256k1AlgorithmIdentifier() (pkix.AlgorithmIdentifier, error) {
+	params, err := asn1.Marshal(oidCurveSecp256k1)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  oidPublicKeyECDSA,
+		Parameters: asn1.RawValue{FullBytes: params},
+	}, nil
+}
+
+func marshalSecp256k1PublicKey(publicKey *secp256k1.PublicKey) ([]byte, error) {
+	algorithm, err := secp256k1AlgorithmIdentifier()
+	if err != nil {
+		return nil, err
+	}
+
+	point := publicKey.SerializeUncompressed()
+	return asn1.Marshal(pkixPublicKey{
+		Algorithm: algorithm,
+		PublicKey: asn1.BitString{Bytes: point, BitLength: len(point) * 8},
+	})
+}
+
+func marshalSecp256k1PrivateKey(privateKey *secp256k1.PrivateKey) ([]byte, error) {
+	algorithm, err := secp256k1AlgorithmIdentifier()
+	if err != nil {
+		return nil, err
+	}
+
+	point := privateKey.PubKey().SerializeUncompressed()
+	inner, err := asn1.Marshal(ecPrivateKey{
+		Version:    1,
+		PrivateKey: privateKey.Serialize(),
+		PublicKey:  asn1.BitString{Bytes: point, BitLength: len(point) * 8},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(pkcs8PrivateKey{
+		Version:    0,
+		Algorithm:  algorithm,
+		PrivateKey: inner,
+	})
+}
+
+func parseSecp256k1PrivateKey(der []byte) (*secp256k1.PrivateKey, error) {
+	var key ecPrivateKey
+	if _, err := asn1.Unmarshal(der, &key); err != nil {
+		return nil, fmt.Errorf("invalid secp256k1 private key: %v", err)
+	}
+	if key.Version != 1 || len(key.PrivateKey) != 32 {
+		return nil, fmt.Errorf("invalid secp256k1 private key")
+	}
+	return secp256k1.PrivKeyFromBytes(key.PrivateKey), nil
+}
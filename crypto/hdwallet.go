@@ -0,0 +1,347 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// HardenedKeyStart is the first hardened child index (BIP-32)
+const HardenedKeyStart uint32 = 0x80000000
+
+// CoinType is the BIP-44 coin type used for AetherChain addresses
+const CoinType uint32 = 7771
+
+// MnemonicEntropyBits is the entropy size of new mnemonics (24 words)
+const MnemonicEntropyBits = 256
+
+// HDWalletVersion is the current HD wallet file format version
+const HDWalletVersion = 1
+
+// ExtendedKey is a BIP-32 extended private key on secp256k1
+type ExtendedKey struct {
+	key       []byte // 32-byte private key
+	chainCode []byte
+	depth     uint8
+	childNum  uint32
+}
+
+// NewMnemonic generates a new BIP-39 mnemonic sentence
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(MnemonicEntropyBits)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate entropy: %v", err)
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// ValidateMnemonic checks the words and checksum of a mnemonic sentence
+func ValidateMnemonic(mnemonic string) bool {
+	return bip39.IsMnemonicValid(mnemonic)
+}
+
+// SeedFromMnemonic derives the BIP-39 seed of a mnemonic and optional passphrase
+func SeedFromMnemonic(mnemonic, passphrase string) ([]byte, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mnemonic: %v", err)
+	}
+	return seed, nil
+}
+
+// NewMasterKey derives the BIP-32 master key from a seed
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("invalid seed length: %d", len(seed))
+	}
+
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	if !isValidPrivateKey(sum[:32]) {
+		return nil, fmt.Errorf("seed produces an invalid master key")
+	}
+
+	return &ExtendedKey{
+		key:       sum[:32],
+		chainCode: sum[32:],
+	}, nil
+}
+
+// Child derives the child key at the given index.
+// Indexes from HardenedKeyStart upwards produce hardened children.
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	var data []byte
+	if index >= HardenedKeyStart {
+		data = append([]byte{0x00}, k.key...)
+	} else {
+		data = secp256k1.PrivKeyFromBytes(k.key).PubKey().SerializeCompressed()
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	// child = parse256(IL) + kpar (mod n)
+	var tweak, parent secp256k1.ModNScalar
+	if overflow := tweak.SetByteSlice(sum[:32]); overflow {
+		return nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+	parent.SetByteSlice(k.key)
+	tweak.Add(&parent)
+	if tweak.IsZero() {
+		return nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+
+	childKey := tweak.Bytes()
+	return &ExtendedKey{
+		key:       childKey[:],
+		chainCode: sum[32:],
+		depth:     k.depth + 1,
+		childNum:  index,
+	}, nil
+}
+
+// Derive derives the key at a path such as "m/44'/7771'/0'/0/5"
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	indexes, err := ParseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := k
+	for _, index := range indexes {
+		key, err = key.Child(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// KeyPair returns the secp256k1 key pair of an extended key
+func (k *ExtendedKey) KeyPair() (*KeyPair, error) {
+	return newKeyPair(secp256k1.PrivKeyFromBytes(k.key))
+}
+
+// Depth returns the number of derivation steps from the master key
+func (k *ExtendedKey) Depth() uint8 {
+	return k.depth
+}
+
+// ParseDerivationPath parses a BIP-32 path into child indexes
+func ParseDerivationPath(path string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if len(parts) == 0 || parts[0] != "m" {
+		return nil, fmt.Errorf("invalid derivation path: %s", path)
+	}
+
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+
+		value, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(value) >= HardenedKeyStart {
+			return nil, fmt.Errorf("invalid derivation path component %q", part)
+		}
+
+		index := uint32(value)
+		if hardened {
+			index += HardenedKeyStart
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// AccountPath returns the BIP-44 path of the Nth external address of an account
+func AccountPath(account, index uint32) string {
+	return fmt.Sprintf("m/44'/%d'/%d'/0/%d", CoinType, account, index)
+}
+
+func isValidPrivateKey(key []byte) bool {
+	var scalar secp256k1.ModNScalar
+	overflow := scalar.SetByteSlice(key)
+	return !overflow && !scalar.IsZero()
+}
+
+// HDWalletFile is the on-disk form of an HD wallet with its encrypted seed
+type HDWalletFile struct {
+	Version  int            `json:"version"`
+	Name     string         `json:"name"`
+	CoinType uint32         `json:"coin_type"`
+	Crypto   KeystoreCrypto `json:"crypto"`
+}
+
+// CreateHDWallet generates a new mnemonic, stores its seed encrypted with
+// passphrase and leaves the wallet unlocked. The mnemonic is returned once
+// and is not stored; it is the only backup of the wallet.
+func (km *KeyManager) CreateHDWallet(name, passphrase string) (string, error) {
+	mnemonic, err := NewMnemonic()
+	if err != nil {
+		return "", err
+	}
+
+	if err := km.RestoreHDWallet(name, mnemonic, passphrase); err != nil {
+		return "", err
+	}
+
+	return mnemonic, nil
+}
+
+// RestoreHDWallet stores the seed of an existing mnemonic encrypted with
+// passphrase and leaves the wallet unlocked
+func (km *KeyManager) RestoreHDWallet(name, mnemonic, passphrase string) error {
+	path, err := km.keyPath(name, ".wallet")
+	if err != nil {
+		return err
+	}
+	if km.HDWalletExists(name) {
+		return fmt.Errorf("wallet %s already exists", name)
+	}
+
+	seed, err := SeedFromMnemonic(mnemonic, "")
+	if err != nil {
+		return err
+	}
+
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := sealSecret(seed, passphrase, []byte(name))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt wallet seed: %v", err)
+	}
+
+	data, err := json.MarshalIndent(HDWalletFile{
+		Version:  HDWalletVersion,
+		Name:     name,
+		CoinType: CoinType,
+		Crypto:   *sealed,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(km.keysDir, 0700); err != nil {
+		return fmt.Errorf("failed to create keys directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save wallet: %v", err)
+	}
+
+	km.mutex.Lock()
+	km.wallets[name] = master
+	km.mutex.Unlock()
+
+	fmt.Printf("👛 HD wallet saved: %s\n", name)
+	return nil
+}
+
+// UnlockHDWallet decrypts a stored HD wallet seed and keeps it available for derivation
+func (km *KeyManager) UnlockHDWallet(name, passphrase string) error {
+	path, err := km.keyPath(name, ".wallet")
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to load wallet: %v", err)
+	}
+
+	var file HDWalletFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid wallet file: %v", err)
+	}
+	if file.Version != HDWalletVersion {
+		return fmt.Errorf("unsupported wallet version: %d", file.Version)
+	}
+
+	seed, err := openSecret(&file.Crypto, passphrase, []byte(file.Name))
+	if err != nil {
+		return err
+	}
+
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		return err
+	}
+
+	km.mutex.Lock()
+	km.wallets[name] = master
+	km.mutex.Unlock()
+
+	fmt.Printf("🔓 HD wallet unlocked: %s\n", name)
+	return nil
+}
+
+// DeriveAddress derives the key pair of the Nth address of an account in an unlocked HD wallet
+func (km *KeyManager) DeriveAddress(name string, account, index uint32) (*KeyPair, error) {
+	return km.DeriveKeyPair(name, AccountPath(account, index))
+}
+
+// DeriveKeyPair derives the key pair at a path in an unlocked HD wallet
+func (km *KeyManager) DeriveKeyPair(name, path string) (*KeyPair, error) {
+	km.mutex.RLock()
+	master, unlocked := km.wallets[name]
+	km.mutex.RUnlock()
+
+	if !unlocked {
+		if !km.HDWalletExists(name) {
+			return nil, fmt.Errorf("wallet %s not found", name)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrKeyLocked, name)
+	}
+
+	key, err := master.Derive(path)
+	if err != nil {
+		return nil, err
+	}
+	return key.KeyPair()
+}
+
+// HDWalletExists checks if an HD wallet with the given name exists
+func (km *KeyManager) HDWalletExists(name string) bool {
+	path, err := km.keyPath(name, ".wallet")
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// ListHDWallets returns the names of all stored HD wallets
+func (km *KeyManager) ListHDWallets() ([]string, error) {
+	files, err := os.ReadDir(km.keysDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	wallets := []string{}
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".wallet" {
+			wallets = append(wallets, strings.TrimSuffix(file.Name(), ".wallet"))
+		}
+	}
+
+	return wallets, nil
+}
@@ -0,0 +1,59 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// BIP-32 test vector 1
+func TestDeriveBIP32Vector1(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		t.Fatalf("NewMasterKey: %v", err)
+	}
+
+	tests := []struct {
+		path      string
+		chainCode string
+		key       string
+	}{
+		{"m", "873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508", "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35"},
+		{"m/0'", "47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141", "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+		{"m/0'/1", "2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19", "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+		{"m/0'/1/2'", "04466b9cc8e161e966409ca52986c584f07e9dc81f735db683c3ff6ec7b1503f", "cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca"},
+	}
+
+	for depth, test := range tests {
+		key, err := master.Derive(test.path)
+		if err != nil {
+			t.Fatalf("Derive(%s): %v", test.path, err)
+		}
+		if got := hex.EncodeToString(key.chainCode); got != test.chainCode {
+			t.Errorf("%s: chain code %s, want %s", test.path, got, test.chainCode)
+		}
+		if got := hex.EncodeToString(key.key); got != test.key {
+			t.Errorf("%s: private key %s, want %s", test.path, got, test.key)
+		}
+		if key.Depth() != uint8(depth) {
+			t.Errorf("%s: depth %d, want %d", test.path, key.Depth(), depth)
+		}
+	}
+}
+
+// BIP-39 reference vector for the all-zero entropy mnemonic
+func TestSeedFromMnemonicVector(t *testing.T) {
+	const mnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	const want = "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"
+
+	if !ValidateMnemonic(mnemonic) {
+		t.Fatal("mnemonic is not valid")
+	}
+	seed, err := SeedFromMnemonic(mnemonic, "TREZOR")
+	if err != nil {
+		t.Fatalf("SeedFromMnemonic: %v", err)
+	}
+	if got := hex.EncodeToString(seed); got != want {
+		t.Errorf("seed %s, want %s", got, want)
+	}
+}
@@ -1,63 +1,111 @@
 package crypto
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
+	"crypto"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/hex"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sync"
 )
 
+// ErrInvalidKeyName is returned for key and wallet names that are not
+// plain file names in the keys directory
+var ErrInvalidKeyName = errors.New("key names may only contain letters, digits, '_' and '-'")
+
+// keyNamePattern matches names that cannot escape the keys directory
+var keyNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
 // KeyManager handles cryptographic key generation and management
 type KeyManager struct {
 	keysDir string
+
+	// Decrypted key pairs and HD wallet master keys by name, see Unlock
+	unlocked map[string]*KeyPair
+	wallets  map[string]*ExtendedKey
+	mutex    sync.RWMutex
 }
 
 // NewKeyManager creates a new key manager
 func NewKeyManager(keysDir string) *KeyManager {
 	return &KeyManager{
-		keysDir: keysDir,
+		keysDir:  keysDir,
+		unlocked: make(map[string]*KeyPair),
+		wallets:  make(map[string]*ExtendedKey),
 	}
 }
 
 // KeyPair represents a public/private key pair
 type KeyPair struct {
-	PrivateKey *rsa.PrivateKey
-	PublicKey  *rsa.PublicKey
+	Algorithm  KeyAlgorithm
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
 	Address    string
 }
 
-// GenerateKeyPair generates a new RSA key pair
-func (km *KeyManager) GenerateKeyPair() (*KeyPair, error) {
-	// Generate RSA key pair
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+// newKeyPair builds a key pair around an existing private key
+func newKeyPair(privateKey crypto.PrivateKey) (*KeyPair, error) {
+	algorithm, err := AlgorithmOf(privateKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate key pair: %v", err)
+		return nil, err
 	}
 
-	// Create key pair structure
 	keyPair := &KeyPair{
+		Algorithm:  algorithm.Name(),
 		PrivateKey: privateKey,
-		PublicKey:  &privateKey.PublicKey,
+		PublicKey:  algorithm.PublicKey(privateKey),
 	}
 
 	// Generate address from public key
-	keyPair.Address = km.generateAddress(keyPair.PublicKey)
+	keyPair.Address, err = AddressFromPublicKey(keyPair.PublicKey)
+	if err != nil {
+		return nil, err
+	}
 
 	return keyPair, nil
 }
 
+// GenerateKeyPair generates a new key pair using the default algorithm
+func (km *KeyManager) GenerateKeyPair() (*KeyPair, error) {
+	return km.GenerateKeyPairWithAlgorithm(DefaultKeyAlgorithm)
+}
+
+// GenerateKeyPairWithAlgorithm generates a new key pair for the given algorithm
+func (km *KeyManager) GenerateKeyPairWithAlgorithm(name KeyAlgorithm) (*KeyPair, error) {
+	algorithm, err := GetAlgorithm(name)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := algorithm.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key pair: %v", err)
+	}
+
+	return newKeyPair(privateKey)
+}
+
 // generateAddress creates a blockchain address from a public key
-func (km *KeyManager) generateAddress(publicKey *rsa.PublicKey) string {
-	// Serialize public key
-	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+func (km *KeyManager) generateAddress(publicKey crypto.PublicKey) string {
+	address, err := AddressFromPublicKey(publicKey)
 	if err != nil {
 		return ""
 	}
+	return address
+}
+
+// AddressFromPublicKey derives a blockchain address from a public key
+func AddressFromPublicKey(publicKey crypto.PublicKey) (string, error) {
+	// Serialize public key
+	publicKeyBytes, err := MarshalPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %v", err)
+	}
 
 	// Hash the public key
 	hash := sha256.Sum256(publicKeyBytes)
@@ -66,30 +114,68 @@ func (km *KeyManager) generateAddress(publicKey *rsa.PublicKey) string {
 	addressBytes := hash[:20]
 
 	// Convert to hex string
-	return "0x" + hex.EncodeToString(addressBytes)
+	return "0x" + hex.EncodeToString(addressBytes), nil
+}
+
+// EncodePublicKey returns the hex-encoded PKIX form of a public key
+func EncodePublicKey(publicKey crypto.PublicKey) (string, error) {
+	publicKeyBytes, err := MarshalPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %v", err)
+	}
+	return hex.EncodeToString(publicKeyBytes), nil
+}
+
+// DecodePublicKey parses a public key produced by EncodePublicKey
+func DecodePublicKey(encoded string) (crypto.PublicKey, error) {
+	publicKeyBytes, err := hex.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key encoding: %v", err)
+	}
+
+	publicKey, err := ParsePublicKey(publicKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+	return publicKey, nil
 }
 
-// SaveKeyPair saves a key pair to disk
+// SaveKeyPair saves a key pair to disk without encryption.
+// Use SaveEncryptedKeyPair to protect the private key with a passphrase.
 func (km *KeyManager) SaveKeyPair(keyPair *KeyPair, name string) error {
+	privateKeyPEM, err := encodePrivateKeyPEM(keyPair.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to save private key: %v", err)
+	}
+
+	return km.writeKeyFiles(keyPair, name, privateKeyPEM)
+}
+
+// writeKeyFiles writes the private key data, public key and address files
+func (km *KeyManager) writeKeyFiles(keyPair *KeyPair, name string, privateKeyData []byte) error {
+	privateKeyPath, err := km.keyPath(name, ".key")
+	if err != nil {
+		return err
+	}
+
 	// Create keys directory if it doesn't exist
 	if err := os.MkdirAll(km.keysDir, 0700); err != nil {
 		return fmt.Errorf("failed to create keys directory: %v", err)
 	}
 
 	// Save private key
-	privateKeyPath := filepath.Join(km.keysDir, name+".key")
-	if err := km.savePrivateKey(keyPair.PrivateKey, privateKeyPath); err != nil {
+	if err := os.WriteFile(privateKeyPath, privateKeyData, 0600); err != nil {
 		return fmt.Errorf("failed to save private key: %v", err)
 	}
 
 	// Save public key
-	publicKeyPath := filepath.Join(km.keysDir, name+".pub")
+	publicKeyPath, _ := km.keyPath(name, ".pub")
 	if err := km.savePublicKey(keyPair.PublicKey, publicKeyPath); err != nil {
 		return fmt.Errorf("failed to save public key: %v", err)
 	}
 
 	// Save address
-	addressPath := filepath.Join(km.keysDir, name+".address")
+	addressPath, _ := km.keyPath(name, ".address")
 	if err := os.WriteFile(addressPath, []byte(keyPair.Address), 0600); err != nil {
 		return fmt.Errorf("failed to save address: %v", err)
 	}
@@ -98,49 +184,69 @@ func (km *KeyManager) SaveKeyPair(keyPair *KeyPair, name string) error {
 	return nil
 }
 
-// LoadKeyPair loads a key pair from disk
+// LoadKeyPair loads a key pair from disk.
+// Encrypted key pairs must be unlocked first; plaintext key files are still
+// read for compatibility and can be converted with MigrateKeyPair.
 func (km *KeyManager) LoadKeyPair(name string) (*KeyPair, error) {
-	// Load private key
-	privateKeyPath := filepath.Join(km.keysDir, name+".key")
-	privateKey, err := km.loadPrivateKey(privateKeyPath)
+	privateKeyPath, err := km.keyPath(name, ".key")
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(privateKeyPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load private key: %v", err)
 	}
 
-	// Create key pair
-	keyPair := &KeyPair{
-		PrivateKey: privateKey,
-		PublicKey:  &privateKey.PublicKey,
+	// Encrypted keystores are only available while unlocked
+	if isKeystore(data) {
+		km.mutex.RLock()
+		keyPair, unlocked := km.unlocked[name]
+		km.mutex.RUnlock()
+		if !unlocked {
+			return nil, fmt.Errorf("%w: %s", ErrKeyLocked, name)
+		}
+		return keyPair, nil
 	}
 
-	// Load or generate address
-	addressPath := filepath.Join(km.keysDir, name+".address")
+	// Load legacy plaintext private key
+	privateKey, err := decodePrivateKeyPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key: %v", err)
+	}
+	fmt.Printf("⚠️ Key %s is stored unencrypted, consider migrating it to an encrypted keystore\n", name)
+
+	// Create key pair, deriving the public key and address
+	keyPair, err := newKeyPair(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key: %v", err)
+	}
+
+	// Prefer the saved address for keys written by older versions
+	addressPath, _ := km.keyPath(name, ".address")
 	if addressData, err := os.ReadFile(addressPath); err == nil {
 		keyPair.Address = string(addressData)
-	} else {
-		// Generate address if not saved
-		keyPair.Address = km.generateAddress(keyPair.PublicKey)
 	}
 
 	return keyPair, nil
 }
 
-// savePrivateKey saves an RSA private key to a file
-func (km *KeyManager) savePrivateKey(privateKey *rsa.PrivateKey, path string) error {
-	// Encode private key to PEM format
-	privateKeyBytes := x509.MarshalPKCS1PrivateKey(privateKey)
-	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: privateKeyBytes,
-	})
+// encodePrivateKeyPEM encodes a private key in PKCS#8 PEM format
+func encodePrivateKeyPEM(privateKey crypto.PrivateKey) ([]byte, error) {
+	privateKeyBytes, err := MarshalPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
 
-	return os.WriteFile(path, privateKeyPEM, 0600)
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privateKeyBytes,
+	}), nil
 }
 
-// savePublicKey saves an RSA public key to a file
-func (km *KeyManager) savePublicKey(publicKey *rsa.PublicKey, path string) error {
+// savePublicKey saves a public key to a file in PKIX PEM format
+func (km *KeyManager) savePublicKey(publicKey crypto.PublicKey, path string) error {
 	// Encode public key to PEM format
-	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	publicKeyBytes, err := MarshalPublicKey(publicKey)
 	if err != nil {
 		return err
 	}
@@ -153,30 +259,27 @@ func (km *KeyManager) savePublicKey(publicKey *rsa.PublicKey, path string) error
 	return os.WriteFile(path, publicKeyPEM, 0644)
 }
 
-// loadPrivateKey loads an RSA private key from a file
-func (km *KeyManager) loadPrivateKey(path string) (*rsa.PrivateKey, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-
+// decodePrivateKeyPEM decodes a PKCS#8 or legacy PKCS#1 PEM private key
+func decodePrivateKeyPEM(data []byte) (crypto.PrivateKey, error) {
 	// Decode PEM data
 	block, _ := pem.Decode(data)
-	if block == nil || block.Type != "RSA PRIVATE KEY" {
+	if block == nil {
 		return nil, fmt.Errorf("invalid private key format")
 	}
 
-	// Parse private key
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-	if err != nil {
-		return nil, err
+	switch block.Type {
+	case "PRIVATE KEY":
+		return ParsePrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		// Legacy PKCS#1 RSA key files
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("invalid private key format")
 	}
-
-	return privateKey, nil
 }
 
 // GetAddressFromPublicKey generates an address from a public key
-func (km *KeyManager) GetAddressFromPublicKey(publicKey *rsa.PublicKey) string {
+func (km *KeyManager) GetAddressFromPublicKey(publicKey crypto.PublicKey) string {
 	return km.generateAddress(publicKey)
 }
 
@@ -202,23 +305,82 @@ func (km *KeyManager) ListKeys() ([]string, error) {
 
 // KeyExists checks if a key pair with the given name exists
 func (km *KeyManager) KeyExists(name string) bool {
-	privateKeyPath := filepath.Join(km.keysDir, name+".key")
-	_, err := os.Stat(privateKeyPath)
+	privateKeyPath, err := km.keyPath(name, ".key")
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(privateKeyPath)
 	return err == nil
 }
 
+// ValidateKeyName checks that a key or wallet name is a plain file name,
+// so that names from API requests cannot reach outside the keys directory
+func ValidateKeyName(name string) error {
+	if !keyNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidKeyName, name)
+	}
+	return nil
+}
+
+// keyPath returns the path of a key or wallet file after validating its name
+func (km *KeyManager) keyPath(name, extension string) (string, error) {
+	if err := ValidateKeyName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(km.keysDir, name+extension), nil
+}
+
 // GetKeyInfo returns information about a key pair
 func (km *KeyManager) GetKeyInfo(name string) (map[string]interface{}, error) {
+	// Locked keystores still expose their public metadata
+	if encrypted, err := km.IsEncrypted(name); err == nil && encrypted && km.IsLocked(name) {
+		keystore, err := km.readKeystore(name)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := DecodePublicKey(keystore.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		algorithm, err := AlgorithmOf(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"name":       name,
+			"address":    keystore.Address,
+			"key_size":   algorithm.KeySize(publicKey),
+			"algorithm":  algorithm.Name(),
+			"public_key": keystore.PublicKey,
+			"encrypted":  true,
+			"locked":     true,
+		}, nil
+	}
+
 	keyPair, err := km.LoadKeyPair(name)
 	if err != nil {
 		return nil, err
 	}
 
+	algorithm, err := AlgorithmOf(keyPair.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := EncodePublicKey(keyPair.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, _ := km.IsEncrypted(name)
+
 	return map[string]interface{}{
 		"name":       name,
 		"address":    keyPair.Address,
-		"key_size":   2048,
-		"algorithm":  "RSA",
-		"public_key": hex.EncodeToString(x509.MarshalPKCS1PublicKey(keyPair.PublicKey)),
+		"key_size":   algorithm.KeySize(keyPair.PublicKey),
+		"algorithm":  algorithm.Name(),
+		"public_key": publicKey,
+		"encrypted":  encrypted,
+		"locked":     false,
 	}, nil
-}
\ No newline at end of file
+}
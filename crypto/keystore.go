@@ -0,0 +1,418 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeystoreVersion is the current encrypted keystore format version
+const KeystoreVersion = 1
+
+// Default scrypt parameters for new keystores
+const (
+	ScryptN      = 1 << 18
+	ScryptR      = 8
+	ScryptP      = 1
+	scryptKeyLen = 32
+)
+
+// Bounds on the scrypt parameters of a keystore, so that an imported
+// keystore cannot make key derivation exhaust memory
+const (
+	maxScryptN = 1 << 20
+	maxScryptR = 8
+	maxScryptP = 16
+)
+
+var (
+	// ErrKeyLocked is returned when an encrypted key is used before Unlock
+	ErrKeyLocked = errors.New("key is locked")
+	// ErrInvalidPassphrase is returned when a keystore cannot be decrypted
+	ErrInvalidPassphrase = errors.New("invalid passphrase")
+)
+
+// Keystore is the versioned JSON envelope of an encrypted private key
+type Keystore struct {
+	Version   int            `json:"version"`
+	Algorithm KeyAlgorithm   `json:"algorithm"`
+	Address   string         `json:"address"`
+	PublicKey string         `json:"public_key"`
+	Crypto    KeystoreCrypto `json:"crypto"`
+}
+
+// KeystoreCrypto holds the cipher and KDF parameters of a keystore
+type KeystoreCrypto struct {
+	Cipher     string       `json:"cipher"`
+	CipherText string       `json:"ciphertext"`
+	Nonce      string       `json:"nonce"`
+	KDF        string       `json:"kdf"`
+	KDFParams  ScryptParams `json:"kdfparams"`
+}
+
+// ScryptParams holds the scrypt key derivation parameters
+type ScryptParams struct {
+	N      int    `json:"n"`
+	R      int    `json:"r"`
+	P      int    `json:"p"`
+	KeyLen int    `json:"dklen"`
+	Salt   string `json:"salt"`
+}
+
+// EncryptKeyPair encrypts a key pair's PKCS#8 private key with a passphrase
+func EncryptKeyPair(keyPair *KeyPair, passphrase string) (*Keystore, error) {
+	publicKey, err := EncodePublicKey(keyPair.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKeyBytes, err := MarshalPrivateKey(keyPair.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// The address is authenticated so the envelope cannot be relabelled
+	sealed, err := sealSecret(privateKeyBytes, passphrase, []byte(keyPair.Address))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Keystore{
+		Version:   KeystoreVersion,
+		Algorithm: keyPair.Algorithm,
+		Address:   keyPair.Address,
+		PublicKey: publicKey,
+		Crypto:    *sealed,
+	}, nil
+}
+
+// DecryptKeystore decrypts a keystore with a passphrase
+func DecryptKeystore(keystore *Keystore, passphrase string) (*KeyPair, error) {
+	if keystore.Version != KeystoreVersion {
+		return nil, fmt.Errorf("unsupported keystore version: %d", keystore.Version)
+	}
+
+	privateKeyBytes, err := openSecret(&keystore.Crypto, passphrase, []byte(keystore.Address))
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := ParsePrivateKey(privateKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse decrypted key: %v", err)
+	}
+
+	keyPair, err := newKeyPair(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if keyPair.Address != keystore.Address {
+		return nil, fmt.Errorf("keystore address mismatch: %s", keystore.Address)
+	}
+
+	return keyPair, nil
+}
+
+// sealSecret encrypts a secret with a passphrase-derived AES-GCM key
+func sealSecret(secret []byte, passphrase string, additionalData []byte) (*KeystoreCrypto, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %v", err)
+	}
+
+	params := ScryptParams{
+		N:      ScryptN,
+		R:      ScryptR,
+		P:      ScryptP,
+		KeyLen: scryptKeyLen,
+		Salt:   hex.EncodeToString(salt),
+	}
+
+	gcm, err := keystoreCipher(passphrase, params)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	return &KeystoreCrypto{
+		Cipher:     "aes-256-gcm",
+		CipherText: hex.EncodeToString(gcm.Seal(nil, nonce, secret, additionalData)),
+		Nonce:      hex.EncodeToString(nonce),
+		KDF:        "scrypt",
+		KDFParams:  params,
+	}, nil
+}
+
+// openSecret decrypts a secret sealed by sealSecret
+func openSecret(sealed *KeystoreCrypto, passphrase string, additionalData []byte) ([]byte, error) {
+	if sealed.Cipher != "aes-256-gcm" || sealed.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported keystore cipher %s/%s", sealed.Cipher, sealed.KDF)
+	}
+
+	cipherText, err := hex.DecodeString(sealed.CipherText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keystore ciphertext: %v", err)
+	}
+	nonce, err := hex.DecodeString(sealed.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keystore nonce: %v", err)
+	}
+
+	gcm, err := keystoreCipher(passphrase, sealed.KDFParams)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid keystore nonce length: %d", len(nonce))
+	}
+
+	secret, err := gcm.Open(nil, nonce, cipherText, additionalData)
+	if err != nil {
+		return nil, ErrInvalidPassphrase
+	}
+	return secret, nil
+}
+
+// validate checks that scrypt parameters are within the supported bounds
+func (params ScryptParams) validate() error {
+	if params.N <= 1 || params.N > maxScryptN || params.N&(params.N-1) != 0 {
+		return fmt.Errorf("unsupported scrypt N %d, must be a power of two up to %d", params.N, maxScryptN)
+	}
+	if params.R < 1 || params.R > maxScryptR {
+		return fmt.Errorf("unsupported scrypt r %d, must be between 1 and %d", params.R, maxScryptR)
+	}
+	if params.P < 1 || params.P > maxScryptP {
+		return fmt.Errorf("unsupported scrypt p %d, must be between 1 and %d", params.P, maxScryptP)
+	}
+	if params.KeyLen != scryptKeyLen {
+		return fmt.Errorf("unsupported scrypt key length %d, must be %d", params.KeyLen, scryptKeyLen)
+	}
+	return nil
+}
+
+// keystoreCipher derives the AES-GCM cipher for a passphrase
+func keystoreCipher(passphrase string, params ScryptParams) (cipher.AEAD, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keystore salt: %v", err)
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, params.KeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// isKeystore reports whether key file data is an encrypted keystore
+func isKeystore(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+// SaveEncryptedKeyPair saves a key pair to disk encrypted with a passphrase
+func (km *KeyManager) SaveEncryptedKeyPair(keyPair *KeyPair, name, passphrase string) error {
+	keystore, err := EncryptKeyPair(keyPair, passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt key pair: %v", err)
+	}
+
+	data, err := json.MarshalIndent(keystore, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := km.writeKeyFiles(keyPair, name, data); err != nil {
+		return err
+	}
+
+	// Keep an unlocked copy in sync with what is now on disk
+	km.mutex.Lock()
+	if _, unlocked := km.unlocked[name]; unlocked {
+		km.unlocked[name] = keyPair
+	}
+	km.mutex.Unlock()
+
+	return nil
+}
+
+// Unlock decrypts a stored key pair and keeps it available to LoadKeyPair
+func (km *KeyManager) Unlock(name, passphrase string) (*KeyPair, error) {
+	keystore, err := km.readKeystore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPair, err := DecryptKeystore(keystore, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	km.mutex.Lock()
+	km.unlocked[name] = keyPair
+	km.mutex.Unlock()
+
+	fmt.Printf("🔓 Key unlocked: %s\n", name)
+	return keyPair, nil
+}
+
+// Lock removes a decrypted key pair or HD wallet from memory
+func (km *KeyManager) Lock(name string) {
+	km.mutex.Lock()
+	defer km.mutex.Unlock()
+
+	_, keyUnlocked := km.unlocked[name]
+	_, walletUnlocked := km.wallets[name]
+	if keyUnlocked || walletUnlocked {
+		delete(km.unlocked, name)
+		delete(km.wallets, name)
+		fmt.Printf("🔒 Key locked: %s\n", name)
+	}
+}
+
+// LockAll removes all decrypted key pairs and HD wallets from memory
+func (km *KeyManager) LockAll() {
+	km.mutex.Lock()
+	defer km.mutex.Unlock()
+
+	km.unlocked = make(map[string]*KeyPair)
+	km.wallets = make(map[string]*ExtendedKey)
+}
+
+// IsLocked reports whether a key pair or HD wallet has not been unlocked
+func (km *KeyManager) IsLocked(name string) bool {
+	km.mutex.RLock()
+	defer km.mutex.RUnlock()
+
+	_, keyUnlocked := km.unlocked[name]
+	_, walletUnlocked := km.wallets[name]
+	return !keyUnlocked && !walletUnlocked
+}
+
+// IsEncrypted reports whether a stored key pair uses the encrypted keystore format
+func (km *KeyManager) IsEncrypted(name string) (bool, error) {
+	path, err := km.keyPath(name, ".key")
+	if err != nil {
+		return false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	return isKeystore(data), nil
+}
+
+// ChangePassphrase re-encrypts a stored key pair with a new passphrase
+func (km *KeyManager) ChangePassphrase(name, oldPassphrase, newPassphrase string) error {
+	keystore, err := km.readKeystore(name)
+	if err != nil {
+		return err
+	}
+
+	keyPair, err := DecryptKeystore(keystore, oldPassphrase)
+	if err != nil {
+		return err
+	}
+
+	return km.SaveEncryptedKeyPair(keyPair, name, newPassphrase)
+}
+
+// MigrateKeyPair converts a legacy plaintext key file into an encrypted keystore
+func (km *KeyManager) MigrateKeyPair(name, passphrase string) error {
+	encrypted, err := km.IsEncrypted(name)
+	if err != nil {
+		return fmt.Errorf("failed to load private key: %v", err)
+	}
+	if encrypted {
+		return fmt.Errorf("key %s is already encrypted", name)
+	}
+
+	keyPair, err := km.LoadKeyPair(name)
+	if err != nil {
+		return err
+	}
+
+	if err := km.SaveEncryptedKeyPair(keyPair, name, passphrase); err != nil {
+		return err
+	}
+
+	fmt.Printf("🔐 Key migrated to encrypted keystore: %s\n", name)
+	return nil
+}
+
+// ExportKeystore returns the encrypted keystore JSON of a stored key pair
+func (km *KeyManager) ExportKeystore(name string) ([]byte, error) {
+	keystore, err := km.readKeystore(name)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(keystore, "", "  ")
+}
+
+// ImportKeystore verifies an encrypted keystore with its passphrase and stores it under name
+func (km *KeyManager) ImportKeystore(name string, data []byte, passphrase string) (*KeyPair, error) {
+	var keystore Keystore
+	if err := json.Unmarshal(data, &keystore); err != nil {
+		return nil, fmt.Errorf("invalid keystore: %v", err)
+	}
+
+	// Check the name before running the expensive key derivation
+	if err := ValidateKeyName(name); err != nil {
+		return nil, err
+	}
+	if km.KeyExists(name) {
+		return nil, fmt.Errorf("key %s already exists", name)
+	}
+
+	keyPair, err := DecryptKeystore(&keystore, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := km.writeKeyFiles(keyPair, name, data); err != nil {
+		return nil, err
+	}
+
+	return keyPair, nil
+}
+
+// readKeystore reads and parses an encrypted keystore file
+func (km *KeyManager) readKeystore(name string) (*Keystore, error) {
+	path, err := km.keyPath(name, ".key")
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key: %v", err)
+	}
+	if !isKeystore(data) {
+		return nil, fmt.Errorf("key %s is not encrypted", name)
+	}
+
+	var keystore Keystore
+	if err := json.Unmarshal(data, &keystore); err != nil {
+		return nil, fmt.Errorf("invalid keystore: %v", err)
+	}
+	return &keystore, nil
+}
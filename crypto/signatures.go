@@ -2,8 +2,6 @@ package crypto
 
 import (
 	"crypto"
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -22,13 +20,14 @@ func NewSigner(km *KeyManager) *Signer {
 	}
 }
 
-// SignData signs the given data with the specified private key
-func (s *Signer) SignData(data []byte, privateKey *rsa.PrivateKey) (string, error) {
-	// Hash the data
-	hashed := sha256.Sum256(data)
+// Sign signs data with a private key of any supported algorithm
+func Sign(data []byte, privateKey crypto.PrivateKey) (string, error) {
+	algorithm, err := AlgorithmOf(privateKey)
+	if err != nil {
+		return "", err
+	}
 
-	// Sign the hash
-	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed[:])
+	signature, err := algorithm.Sign(privateKey, data)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign data: %v", err)
 	}
@@ -37,29 +36,39 @@ func (s *Signer) SignData(data []byte, privateKey *rsa.PrivateKey) (string, erro
 	return hex.EncodeToString(signature), nil
 }
 
-// VerifySignature verifies a signature against the given data and public key
-func (s *Signer) VerifySignature(data []byte, signature string, publicKey *rsa.PublicKey) bool {
+// Verify verifies a hex signature over data with a public key of any supported algorithm
+func Verify(data []byte, signature string, publicKey crypto.PublicKey) bool {
+	algorithm, err := AlgorithmOf(publicKey)
+	if err != nil {
+		return false
+	}
+
 	// Decode signature
 	sigBytes, err := hex.DecodeString(signature)
 	if err != nil {
 		return false
 	}
 
-	// Hash the data
-	hashed := sha256.Sum256(data)
+	return algorithm.Verify(publicKey, data, sigBytes)
+}
 
-	// Verify the signature
-	err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], sigBytes)
-	return err == nil
+// SignData signs the given data with the specified private key
+func (s *Signer) SignData(data []byte, privateKey crypto.PrivateKey) (string, error) {
+	return Sign(data, privateKey)
+}
+
+// VerifySignature verifies a signature against the given data and public key
+func (s *Signer) VerifySignature(data []byte, signature string, publicKey crypto.PublicKey) bool {
+	return Verify(data, signature, publicKey)
 }
 
 // SignTransaction signs a transaction with the given private key
-func (s *Signer) SignTransaction(txData []byte, privateKey *rsa.PrivateKey) (string, error) {
+func (s *Signer) SignTransaction(txData []byte, privateKey crypto.PrivateKey) (string, error) {
 	return s.SignData(txData, privateKey)
 }
 
 // VerifyTransactionSignature verifies a transaction signature
-func (s *Signer) VerifyTransactionSignature(txData []byte, signature string, publicKey *rsa.PublicKey) bool {
+func (s *Signer) VerifyTransactionSignature(txData []byte, signature string, publicKey crypto.PublicKey) bool {
 	return s.VerifySignature(txData, signature, publicKey)
 }
 
@@ -81,17 +90,15 @@ func (s *Signer) GenerateSignature(message string, keyName string) (string, erro
 }
 
 // VerifyMessageSignature verifies a message signature
-func (s *Signer) VerifyMessageSignature(message, signature string, publicKey *rsa.PublicKey) bool {
+func (s *Signer) VerifyMessageSignature(message, signature string, publicKey crypto.PublicKey) bool {
 	return s.VerifySignature([]byte(message), signature, publicKey)
 }
 
 // GetPublicKeyFromSignature recovers public key information from signature (placeholder)
-// Note: In real RSA, you can't recover public key from signature alone
-// This is a simplified version for demonstration
-func (s *Signer) GetPublicKeyFromSignature(data []byte, signature string) (*rsa.PublicKey, error) {
-	// In a real implementation, this would require additional context
-	// For now, return an error as this is not straightforward with RSA
-	return nil, fmt.Errorf("public key recovery not supported with RSA")
+// Note: None of the supported encodings carry a recovery id, so the public key
+// cannot be recovered from the signature alone
+func (s *Signer) GetPublicKeyFromSignature(data []byte, signature string) (crypto.PublicKey, error) {
+	return nil, fmt.Errorf("public key recovery not supported")
 }
 
 // SignatureInfo represents information about a signature
@@ -103,7 +110,7 @@ type SignatureInfo struct {
 }
 
 // GetSignatureInfo returns information about a signature
-func (s *Signer) GetSignatureInfo(data []byte, signature string, publicKey *rsa.PublicKey) (*SignatureInfo, error) {
+func (s *Signer) GetSignatureInfo(data []byte, signature string, publicKey crypto.PublicKey) (*SignatureInfo, error) {
 	// Verify signature first
 	if !s.VerifySignature(data, signature, publicKey) {
 		return nil, fmt.Errorf("invalid signature")
@@ -115,10 +122,15 @@ func (s *Signer) GetSignatureInfo(data []byte, signature string, publicKey *rsa.
 	// Generate address from public key
 	address := s.keyManager.GetAddressFromPublicKey(publicKey)
 
+	algorithm, err := AlgorithmOf(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
 	return &SignatureInfo{
-		Algorithm: "RSA-SHA256",
+		Algorithm: algorithm.SignatureScheme(),
 		Hash:      hex.EncodeToString(hashed[:]),
-		KeySize:   2048,
+		KeySize:   algorithm.KeySize(publicKey),
 		Address:   address,
 	}, nil
 }
@@ -138,29 +150,34 @@ func (s *Signer) BatchVerify(verifications []VerificationRequest) ([]bool, error
 type VerificationRequest struct {
 	Data      []byte
 	Signature string
-	PublicKey *rsa.PublicKey
+	PublicKey crypto.PublicKey
 }
 
 // CreateDetachedSignature creates a detached signature package
-func (s *Signer) CreateDetachedSignature(data []byte, privateKey *rsa.PrivateKey) (map[string]interface{}, error) {
+func (s *Signer) CreateDetachedSignature(data []byte, privateKey crypto.PrivateKey) (map[string]interface{}, error) {
 	signature, err := s.SignData(data, privateKey)
 	if err != nil {
 		return nil, err
 	}
 
+	algorithm, err := AlgorithmOf(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
 	// Calculate data hash
 	hashed := sha256.Sum256(data)
 
 	return map[string]interface{}{
 		"signature": signature,
 		"data_hash": hex.EncodeToString(hashed[:]),
-		"algorithm": "RSA-SHA256",
+		"algorithm": algorithm.SignatureScheme(),
 		"timestamp": time.Now().Unix(),
 	}, nil
 }
 
 // VerifyDetachedSignature verifies a detached signature
-func (s *Signer) VerifyDetachedSignature(data []byte, signaturePackage map[string]interface{}, publicKey *rsa.PublicKey) bool {
+func (s *Signer) VerifyDetachedSignature(data []byte, signaturePackage map[string]interface{}, publicKey crypto.PublicKey) bool {
 	signature, ok := signaturePackage["signature"].(string)
 	if !ok {
 		return false
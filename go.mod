@@ -7,8 +7,11 @@ toolchain go1.24.9
 replace github.com/javadtorabikh/AetherChain => .
 
 require (
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.4.1
 	github.com/gin-gonic/gin v1.11.0
 	github.com/javadtorabikh/AetherChain v0.0.0-00010101000000-000000000000
+	github.com/tyler-smith/go-bip39 v1.1.0
+	golang.org/x/crypto v0.40.0
 )
 
 require (
@@ -35,7 +38,6 @@ require (
 	github.com/ugorji/go/codec v1.3.0 // indirect
 	go.uber.org/mock v0.5.0 // indirect
 	golang.org/x/arch v0.20.0 // indirect
-	golang.org/x/crypto v0.40.0 // indirect
 	golang.org/x/mod v0.25.0 // indirect
 	golang.org/x/net v0.42.0 // indirect
 	golang.org/x/sync v0.16.0 // indirect
@@ -10,6 +10,7 @@ import (
 	"aetherchain/config"
 	"aetherchain/blockchain"
 	"aetherchain/network"
+	"aetherchain/storage"
 	"aetherchain/api"
 )
 
@@ -35,12 +36,44 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Configure the coin denomination before any amounts are handled
+	denomination := blockchain.Denomination{Symbol: cfg.CoinSymbol, Decimals: cfg.CoinDecimals}
+	if err := blockchain.SetDenomination(denomination); err != nil {
+		log.Fatalf("Invalid denomination configuration: %v", err)
+	}
+
+	emission, err := emissionSchedule(cfg)
+	if err != nil {
+		log.Fatalf("Invalid emission configuration: %v", err)
+	}
+
+	retarget := blockchain.RetargetPolicy{
+		TargetBlockTime:  cfg.TargetBlockTime,
+		RetargetInterval: cfg.RetargetInterval,
+		PowLimitBits:     cfg.PowLimitBits,
+	}
+	if err := retarget.Validate(); err != nil {
+		log.Fatalf("Invalid difficulty retarget configuration: %v", err)
+	}
+
 	// Initialize blockchain
-	bc := blockchain.NewBlockchain(cfg.Difficulty, cfg.BlockReward)
+	bc := blockchain.NewBlockchain(cfg.GenesisBits, emission, retarget)
 	fmt.Printf("📦 Blockchain initialized with genesis block\n")
 
+	// Initialize storage for node data such as banned peers
+	db := storage.NewDatabase(cfg.DataDirectory, bc)
+	if err := db.Initialize(); err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
 	// Initialize network node
 	node := network.NewNode(cfg, bc)
+	if err := node.SetBanStore(db); err != nil {
+		log.Fatalf("Failed to load banned peers: %v", err)
+	}
+	if err := node.SetAddressStore(db); err != nil {
+		log.Fatalf("Failed to load known peers: %v", err)
+	}
 	
 	// Start network services
 	if err := node.Start(); err != nil {
@@ -65,8 +98,8 @@ func main() {
 	fmt.Printf("📍 Node ID: %s\n", cfg.NodeID)
 	fmt.Printf("🌍 Environment: %s\n", cfg.Environment)
 	fmt.Printf("⛓️  Chain Height: %d\n", len(bc.Chain))
-	fmt.Printf("🎯 Difficulty: %d\n", cfg.Difficulty)
-	fmt.Printf("💰 Block Reward: %.2f\n", cfg.BlockReward)
+	fmt.Printf("🎯 Difficulty: %.2f (bits %#08x)\n", bc.GetNextDifficulty(), bc.GetNextBits())
+	fmt.Printf("💰 Block Reward: %s %s\n", bc.GetBlockReward(len(bc.Chain)), cfg.CoinSymbol)
 	fmt.Printf("\n")
 
 	// Wait for interrupt signal to gracefully shutdown
@@ -75,6 +108,25 @@ func main() {
 	fmt.Println("👋 AetherChain node stopped gracefully")
 }
 
+// emissionSchedule builds the monetary policy from the configured coin amounts
+func emissionSchedule(cfg *config.Config) (blockchain.EmissionSchedule, error) {
+	var schedule blockchain.EmissionSchedule
+	var err error
+
+	if schedule.InitialReward, err = blockchain.AmountFromFloat(cfg.BlockReward); err != nil {
+		return schedule, fmt.Errorf("block reward: %v", err)
+	}
+	if schedule.TailEmission, err = blockchain.AmountFromFloat(cfg.TailEmission); err != nil {
+		return schedule, fmt.Errorf("tail emission: %v", err)
+	}
+	if schedule.MaxSupply, err = blockchain.AmountFromFloat(cfg.MaxSupply); err != nil {
+		return schedule, fmt.Errorf("max supply: %v", err)
+	}
+	schedule.HalvingInterval = cfg.HalvingInterval
+
+	return schedule, schedule.Validate()
+}
+
 // waitForShutdown handles graceful shutdown on interrupt signals
 func waitForShutdown(node *network.Node) {
 	sigCh := make(chan os.Signal, 1)
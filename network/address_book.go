@@ -0,0 +1,375 @@
+package network
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	mrand "math/rand/v2"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"aetherchain/storage"
+)
+
+// Address book. Peer addresses are kept in two tables, as in Bitcoin's
+// address manager: new for addresses heard of but never connected to, and
+// tried for addresses a connection succeeded to. Each table is split into
+// buckets picked by a keyed hash of the address's network group and, for
+// new addresses, the group of the peer that advertised it. Addresses from
+// one source or one network can therefore only fill a few buckets, so a
+// peer cannot flood the book with addresses it controls.
+const (
+	newBucketCount           = 64
+	triedBucketCount         = 16
+	bucketSize               = 64
+	newBucketsPerSourceGroup = 8 // New buckets the addresses of one source group may use
+	triedBucketsPerGroup     = 4 // Tried buckets the addresses of one group may use
+
+	// MaxAddrPerMessage bounds the addresses of a peers message
+	MaxAddrPerMessage = 1000
+
+	addressRetryDelay = time.Minute         // Between attempts to the same address
+	addressHorizon    = 30 * 24 * time.Hour // Addresses not advertised for this long are forgotten
+	maxNewFailures    = 3                   // Failed attempts before a new address is forgotten
+	maxTriedFailures  = 10                  // Failed attempts before a tried address is forgotten
+)
+
+// knownAddress is an address book entry and the bucket it is kept in
+type knownAddress struct {
+	storage.PeerAddress
+	bucket int
+}
+
+// AddressBook keeps the addresses of peers that may be connected to
+type AddressBook struct {
+	mutex     sync.Mutex
+	key       [32]byte // Secret bucket hash key, so that buckets cannot be predicted
+	addresses map[string]*knownAddress
+	buckets   [2][][]*knownAddress // New and tried tables
+}
+
+// Address book tables
+const (
+	tableNew   = 0
+	tableTried = 1
+)
+
+// NewAddressBook creates an empty address book
+func NewAddressBook() *AddressBook {
+	book := &AddressBook{addresses: make(map[string]*knownAddress)}
+	rand.Read(book.key[:])
+	book.buckets[tableNew] = make([][]*knownAddress, newBucketCount)
+	book.buckets[tableTried] = make([][]*knownAddress, triedBucketCount)
+	return book
+}
+
+// Add records an address advertised by a source and reports whether the
+// address was new
+func (b *AddressBook) Add(address, source string, seen time.Time) bool {
+	if err := validPeerAddress(address); err != nil {
+		return false
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if known, exists := b.addresses[address]; exists {
+		known.LastSeen = max(known.LastSeen, seen.Unix())
+		return false
+	}
+	known := &knownAddress{PeerAddress: storage.PeerAddress{
+		Address:  address,
+		Source:   hostOf(source),
+		LastSeen: seen.Unix(),
+	}}
+	b.insert(known, tableNew)
+	return true
+}
+
+// Attempt records a connection attempt to an address
+func (b *AddressBook) Attempt(address string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if known, exists := b.addresses[address]; exists {
+		known.LastAttempt = time.Now().Unix()
+		known.Attempts++
+	}
+}
+
+// Good records a successful connection to an address and moves it to the
+// tried table
+func (b *AddressBook) Good(address string) {
+	if err := validPeerAddress(address); err != nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now().Unix()
+	known, exists := b.addresses[address]
+	if !exists {
+		known = &knownAddress{PeerAddress: storage.PeerAddress{Address: address, Source: hostOf(address)}}
+	}
+	known.LastSeen = now
+	known.LastSuccess = now
+	known.Attempts = 0
+	if known.Tried {
+		return
+	}
+	if exists {
+		b.remove(known)
+	}
+	b.insert(known, tableTried)
+}
+
+// Remove forgets an address
+func (b *AddressBook) Remove(address string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if known, exists := b.addresses[address]; exists {
+		b.remove(known)
+	}
+}
+
+// Select picks a random address to connect to, skipping addresses that were
+// attempted recently or for which skip returns true. Tried and new
+// addresses are picked with equal chance. It returns "" if none qualifies.
+func (b *AddressBook) Select(skip func(address string) bool) string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	retryBefore := time.Now().Add(-addressRetryDelay).Unix()
+	tables := []int{tableNew, tableTried}
+	if mrand.IntN(2) == 0 {
+		tables[0], tables[1] = tables[1], tables[0]
+	}
+	for _, table := range tables {
+		var candidates []string
+		for _, bucket := range b.buckets[table] {
+			for _, known := range bucket {
+				if known.LastAttempt > retryBefore || skip(known.Address) {
+					continue
+				}
+				candidates = append(candidates, known.Address)
+			}
+		}
+		if len(candidates) > 0 {
+			return candidates[mrand.IntN(len(candidates))]
+		}
+	}
+	return ""
+}
+
+// Addresses returns up to max random addresses to advertise to peers
+func (b *AddressBook) Addresses(max int) []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	addresses := make([]string, 0, len(b.addresses))
+	for address, known := range b.addresses {
+		if !known.terrible(now) {
+			addresses = append(addresses, address)
+		}
+	}
+	mrand.Shuffle(len(addresses), func(i, j int) { addresses[i], addresses[j] = addresses[j], addresses[i] })
+	return addresses[:min(len(addresses), max)]
+}
+
+// Export forgets stale and unreachable addresses and returns the rest,
+// sorted by address
+func (b *AddressBook) Export() []storage.PeerAddress {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	entries := make([]storage.PeerAddress, 0, len(b.addresses))
+	for _, known := range b.addresses {
+		if known.terrible(now) {
+			b.remove(known)
+			continue
+		}
+		entries = append(entries, known.PeerAddress)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Address < entries[j].Address })
+	return entries
+}
+
+// Import adds previously exported entries
+func (b *AddressBook) Import(entries []storage.PeerAddress) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, entry := range entries {
+		if _, exists := b.addresses[entry.Address]; exists || validPeerAddress(entry.Address) != nil {
+			continue
+		}
+		table := tableNew
+		if entry.Tried {
+			table = tableTried
+		}
+		b.insert(&knownAddress{PeerAddress: entry}, table)
+	}
+}
+
+// Size returns the number of new and tried addresses
+func (b *AddressBook) Size() (int, int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	tried := 0
+	for _, known := range b.addresses {
+		if known.Tried {
+			tried++
+		}
+	}
+	return len(b.addresses) - tried, tried
+}
+
+// insert adds an address to a table, making room in its bucket if needed.
+// A full new bucket forgets its worst address, while a full tried bucket
+// moves its least recently connected address back to the new table.
+func (b *AddressBook) insert(known *knownAddress, table int) {
+	known.Tried = table == tableTried
+	if known.Tried {
+		known.bucket = b.triedBucket(known.Address)
+	} else {
+		known.bucket = b.newBucket(known.Address, known.Source)
+	}
+
+	if bucket := b.buckets[table][known.bucket]; len(bucket) >= bucketSize {
+		if known.Tried {
+			evicted := oldestBy(bucket, func(k *knownAddress) int64 { return k.LastSuccess })
+			b.remove(evicted)
+			b.insert(evicted, tableNew)
+		} else {
+			b.remove(b.worstNew(bucket))
+		}
+	}
+
+	b.buckets[table][known.bucket] = append(b.buckets[table][known.bucket], known)
+	b.addresses[known.Address] = known
+}
+
+// remove takes an address out of its bucket and the book
+func (b *AddressBook) remove(known *knownAddress) {
+	table := tableNew
+	if known.Tried {
+		table = tableTried
+	}
+	bucket := b.buckets[table][known.bucket]
+	for i, entry := range bucket {
+		if entry == known {
+			b.buckets[table][known.bucket] = append(bucket[:i], bucket[i+1:]...)
+			break
+		}
+	}
+	delete(b.addresses, known.Address)
+}
+
+// worstNew returns the address of a new bucket to forget, preferring one
+// that is stale or unreachable over the least recently advertised
+func (b *AddressBook) worstNew(bucket []*knownAddress) *knownAddress {
+	now := time.Now()
+	for _, known := range bucket {
+		if known.terrible(now) {
+			return known
+		}
+	}
+	return oldestBy(bucket, func(k *knownAddress) int64 { return k.LastSeen })
+}
+
+// newBucket picks the new bucket of an address advertised by a source
+func (b *AddressBook) newBucket(address, source string) int {
+	sourceGroup := addressGroup(source)
+	slot := b.hash("new", addressGroup(address), sourceGroup) % newBucketsPerSourceGroup
+	return int(b.hash("new", sourceGroup, strconv.FormatUint(slot, 10)) % newBucketCount)
+}
+
+// triedBucket picks the tried bucket of an address
+func (b *AddressBook) triedBucket(address string) int {
+	slot := b.hash("tried", address) % triedBucketsPerGroup
+	return int(b.hash("tried", addressGroup(address), strconv.FormatUint(slot, 10)) % triedBucketCount)
+}
+
+// hash is a keyed hash of the given strings
+func (b *AddressBook) hash(parts ...string) uint64 {
+	h := sha256.New()
+	h.Write(b.key[:])
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return binary.BigEndian.Uint64(h.Sum(nil))
+}
+
+// terrible reports whether an address is not worth keeping: not advertised
+// for too long, or failing too often
+func (k *knownAddress) terrible(now time.Time) bool {
+	if k.LastSeen > 0 && now.Sub(time.Unix(k.LastSeen, 0)) > addressHorizon {
+		return true
+	}
+	if k.LastSuccess == 0 {
+		return k.Attempts >= maxNewFailures
+	}
+	return k.Attempts >= maxTriedFailures
+}
+
+// oldestBy returns the entry with the lowest value of a timestamp
+func oldestBy(entries []*knownAddress, timestamp func(*knownAddress) int64) *knownAddress {
+	oldest := entries[0]
+	for _, entry := range entries[1:] {
+		if timestamp(entry) < timestamp(oldest) {
+			oldest = entry
+		}
+	}
+	return oldest
+}
+
+// addressGroup returns the network an address belongs to: its /16 for
+// IPv4, its /32 for IPv6, and a single group for loopback addresses
+func addressGroup(address string) string {
+	ip := net.ParseIP(hostOf(address))
+	switch {
+	case ip == nil:
+		return hostOf(address)
+	case ip.IsLoopback():
+		return "local"
+	case ip.To4() != nil:
+		return ip.Mask(net.CIDRMask(16, 32)).String()
+	default:
+		return ip.Mask(net.CIDRMask(32, 128)).String()
+	}
+}
+
+// routableAddress reports whether an address is reachable over the public
+// internet, as opposed to loopback, private and link-local addresses
+func routableAddress(address string) bool {
+	ip := net.ParseIP(hostOf(address))
+	return ip != nil && !ip.IsLoopback() && !ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast()
+}
+
+// validPeerAddress checks that an address is an IP address and port a
+// peer could be listening on
+func validPeerAddress(address string) error {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("invalid peer host %s", host)
+	}
+	if port, err := strconv.Atoi(portString); err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("invalid peer port %s", portString)
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	mrand "math/rand/v2"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	reconnectBaseDelay  = 5 * time.Second  // Before reconnecting to a persistent peer
+	reconnectMaxDelay   = 10 * time.Minute // Bound of the exponential reconnect backoff
+	connManagerInterval = time.Second      // Between checks of the persistent peers
+)
+
+// errSelfConnection is returned by the handshake when a peer turns out to
+// be this node, reached through one of its own addresses
+var errSelfConnection = errors.New("connected to ourselves")
+
+// persistentPeer is an address the node keeps reconnecting to
+type persistentPeer struct {
+	address     string
+	identity    string    // Pinned identity address, empty if not pinned
+	failures    int       // Failed connections since the last success
+	nextAttempt time.Time // Earliest time of the next connection attempt
+}
+
+// ConnManager owns the node's connections. It limits inbound and outbound
+// slots, keeps persistent peers connected with exponential backoff, refuses
+// duplicate and self connections, and tracks every connection and goroutine
+// so that the node can stop cleanly.
+type ConnManager struct {
+	node *Node
+
+	mutex         sync.Mutex
+	inbound       int             // Inbound slots in use, from accept to disconnect
+	outbound      map[string]bool // Addresses holding an outbound slot, from dial to disconnect
+	persistent    map[string]*persistentPeer
+	selfAddresses map[string]bool   // Addresses that turned out to be our own
+	conns         map[net.Conn]bool // Open connections, closed on stop
+	stopping      bool
+
+	ctx        context.Context // Cancelled on stop to abort dials
+	cancel     context.CancelFunc
+	goroutines sync.WaitGroup
+}
+
+// NewConnManager creates a connection manager for a node
+func NewConnManager(node *Node) *ConnManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ConnManager{
+		node:          node,
+		outbound:      make(map[string]bool),
+		persistent:    make(map[string]*persistentPeer),
+		selfAddresses: make(map[string]bool),
+		conns:         make(map[net.Conn]bool),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// goroutine runs f in a goroutine that stop waits for. It reports false,
+// without running f, once the manager is stopping.
+func (cm *ConnManager) goroutine(f func()) bool {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	if cm.stopping {
+		return false
+	}
+	cm.goroutines.Add(1)
+	go func() {
+		defer cm.goroutines.Done()
+		f()
+	}()
+	return true
+}
+
+// run reconnects persistent peers until stopCh is closed
+func (cm *ConnManager) run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(connManagerInterval)
+	defer ticker.Stop()
+
+	cm.connectPersistent()
+	for {
+		select {
+		case <-ticker.C:
+			cm.connectPersistent()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// stop closes every connection, including those still handshaking, and
+// waits for all tracked goroutines to return
+func (cm *ConnManager) stop() {
+	cm.mutex.Lock()
+	cm.stopping = true
+	cm.cancel()
+	for conn := range cm.conns {
+		conn.Close()
+	}
+	cm.mutex.Unlock()
+
+	cm.goroutines.Wait()
+}
+
+// AddPersistentPeer adds an address the node connects to and reconnects to
+// whenever the connection is lost. An address of the form identity@host:port
+// pins the peer's transport identity, so that only an encrypted connection
+// proving that identity is accepted.
+func (n *Node) AddPersistentPeer(address string) error {
+	identity, address := splitPinnedAddress(address)
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return fmt.Errorf("invalid peer address %s: %v", address, err)
+	}
+	if identity != "" && !n.config.P2PEncryption && !n.config.P2PRequireEncryption {
+		return fmt.Errorf("cannot pin the identity of %s with encryption disabled", address)
+	}
+
+	cm := n.connManager
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	peer, exists := cm.persistent[address]
+	if !exists {
+		peer = &persistentPeer{address: address}
+		cm.persistent[address] = peer
+	}
+	if identity != "" {
+		peer.identity = identity
+	}
+	return nil
+}
+
+// splitPinnedAddress splits an address of the form identity@host:port
+func splitPinnedAddress(address string) (string, string) {
+	if identity, hostPort, pinned := strings.Cut(address, "@"); pinned {
+		return identity, hostPort
+	}
+	return "", address
+}
+
+// hasPinnedPeer reports whether any of addresses pins an identity
+func hasPinnedPeer(addresses []string) bool {
+	for _, address := range addresses {
+		if identity, _ := splitPinnedAddress(address); identity != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPersistentPeers returns the addresses the node keeps connected to
+func (n *Node) GetPersistentPeers() []string {
+	cm := n.connManager
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	addresses := make([]string, 0, len(cm.persistent))
+	for address := range cm.persistent {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// connectPersistent dials the persistent peers that are not connected and
+// whose backoff has passed
+func (cm *ConnManager) connectPersistent() {
+	now := time.Now()
+
+	cm.mutex.Lock()
+	var due []string
+	for address, peer := range cm.persistent {
+		if !cm.outbound[address] && now.After(peer.nextAttempt) {
+			due = append(due, address)
+		}
+	}
+	cm.mutex.Unlock()
+
+	for _, address := range due {
+		if !cm.node.HasPeer(address) {
+			cm.node.ConnectToNode(address)
+		}
+	}
+}
+
+// ConnectToNode connects to a node in the background if an outbound slot is
+// free and no connection to it exists or is being made
+func (n *Node) ConnectToNode(address string) error {
+	if err := n.connManager.reserveOutbound(address); err != nil {
+		return err
+	}
+	if !n.connManager.goroutine(func() { n.connectOutbound(address) }) {
+		n.connManager.releaseOutbound(address)
+		return fmt.Errorf("node is stopping")
+	}
+	return nil
+}
+
+// reserveOutbound takes an outbound slot for an address
+func (cm *ConnManager) reserveOutbound(address string) error {
+	if cm.node.HasPeer(address) {
+		return fmt.Errorf("already connected to %s", address)
+	}
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	switch {
+	case cm.selfAddresses[address]:
+		return fmt.Errorf("%s is our own address", address)
+	case cm.outbound[address]:
+		return fmt.Errorf("already connecting to %s", address)
+	case len(cm.outbound) >= cm.node.config.MaxOutboundPeers:
+		return fmt.Errorf("all %d outbound slots are in use", cm.node.config.MaxOutboundPeers)
+	}
+	cm.outbound[address] = true
+	return nil
+}
+
+// releaseOutbound frees the outbound slot of an address
+func (cm *ConnManager) releaseOutbound(address string) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	delete(cm.outbound, address)
+}
+
+// outboundCount returns the number of outbound slots in use
+func (cm *ConnManager) outboundCount() int {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	return len(cm.outbound)
+}
+
+// connecting reports whether an address holds an outbound slot
+func (cm *ConnManager) connecting(address string) bool {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	return cm.outbound[address]
+}
+
+// reserveInbound takes an inbound slot, if one is free
+func (cm *ConnManager) reserveInbound() bool {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	if cm.inbound >= cm.node.config.MaxInboundPeers {
+		return false
+	}
+	cm.inbound++
+	return true
+}
+
+// releaseInbound frees an inbound slot
+func (cm *ConnManager) releaseInbound() {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	cm.inbound--
+}
+
+// track registers an open connection so that stop closes it. It reports
+// false, and closes the connection, once the manager is stopping.
+func (cm *ConnManager) track(conn net.Conn) bool {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	if cm.stopping {
+		conn.Close()
+		return false
+	}
+	cm.conns[conn] = true
+	return true
+}
+
+// untrack closes a connection and forgets it
+func (cm *ConnManager) untrack(conn net.Conn) {
+	conn.Close()
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	delete(cm.conns, conn)
+}
+
+// checkIdentity checks the transport identity of an outbound connection
+// against the identity pinned for a persistent peer, if any
+func (cm *ConnManager) checkIdentity(address string, identity *peerIdentity) error {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	peer, exists := cm.persistent[address]
+	switch {
+	case !exists || peer.identity == "":
+		return nil
+	case identity == nil:
+		return fmt.Errorf("peer is pinned to identity %s but did not encrypt", peer.identity)
+	case identity.address != peer.identity:
+		return fmt.Errorf("identity %s does not match the pinned identity %s", identity.address, peer.identity)
+	}
+	return nil
+}
+
+// connectFailed schedules the next attempt to a persistent peer with
+// exponential backoff, and forgets addresses that turned out to be our own
+func (cm *ConnManager) connectFailed(address string, err error) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	if errors.Is(err, errSelfConnection) {
+		fmt.Printf("🪞 %s is our own address, not connecting to it again\n", address)
+		cm.selfAddresses[address] = true
+		delete(cm.persistent, address)
+		cm.node.discovery.book.Remove(address)
+		return
+	}
+
+	if peer, exists := cm.persistent[address]; exists {
+		peer.failures++
+		delay := reconnectDelay(peer.failures)
+		peer.nextAttempt = time.Now().Add(delay)
+		fmt.Printf("🔁 Reconnecting to %s in %s\n", address, delay.Round(time.Second))
+	}
+}
+
+// connected resets the backoff of a persistent peer
+func (cm *ConnManager) connected(address string) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	if peer, exists := cm.persistent[address]; exists {
+		peer.failures = 0
+	}
+}
+
+// disconnected schedules the reconnection of a persistent peer
+func (cm *ConnManager) disconnected(address string) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	if peer, exists := cm.persistent[address]; exists {
+		peer.nextAttempt = time.Now().Add(reconnectDelay(peer.failures))
+	}
+}
+
+// reconnectDelay doubles the base delay for each failure up to the maximum,
+// with up to 25% jitter so that peers reconnecting to each other do not
+// keep colliding
+func reconnectDelay(failures int) time.Duration {
+	delay := reconnectBaseDelay << min(failures, 16)
+	delay = min(delay, reconnectMaxDelay)
+	return delay + time.Duration(mrand.Int64N(int64(delay/4)+1))
+}
@@ -0,0 +1,170 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Protocol versions this node speaks
+const (
+	ProtocolVersion    uint32 = 1
+	MinProtocolVersion uint32 = 1
+)
+
+// Services a node offers, advertised as a bitmask in the version message
+const (
+	ServiceBlocks     uint64 = 1 << 0 // Serves full blocks from get_blocks
+	ServiceHeaders    uint64 = 1 << 1 // Serves headers from get_headers
+	ServiceEncryption uint64 = 1 << 2 // Has a transport identity and offers encrypted transport
+)
+
+// localServices are the services every node offers
+const localServices = ServiceBlocks | ServiceHeaders
+
+// handshakeTimeout bounds the version/verack exchange
+const handshakeTimeout = 10 * time.Second
+
+// VersionMessage data announcing a node when a connection is opened
+type VersionMessage struct {
+	ProtocolVersion uint32 `json:"protocol_version"`
+	NodeID          string `json:"node_id"`
+	UserAgent       string `json:"user_agent"`
+	GenesisHash     string `json:"genesis_hash"` // Hash of the sender's first block
+	Height          int    `json:"height"`       // Index of the sender's tip
+	Services        uint64 `json:"services"`
+	ListenAddress   string `json:"listen_address"`
+}
+
+// VerackMessage data acknowledging an accepted version message
+type VerackMessage struct{}
+
+// handshake exchanges version messages with a new peer and waits for it to
+// acknowledge ours. Both sides send their version first and a verack once
+// they accept the other's, so no other message may arrive in between.
+// On success the peer is identified by its advertised node ID.
+func (n *Node) handshake(peer *Peer) error {
+	peer.Conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer peer.Conn.SetDeadline(time.Time{})
+
+	n.sendMessage(peer, MessageTypeVersion, VersionMessage{
+		ProtocolVersion: ProtocolVersion,
+		NodeID:          n.config.NodeID,
+		UserAgent:       "aetherchain/" + n.config.Version,
+		GenesisHash:     n.genesisHash(),
+		Height:          n.blockchain.GetLastBlock().Index,
+		Services:        n.services(),
+		ListenAddress:   n.localAddress(),
+	})
+
+	var version *VersionMessage
+	for {
+		message, err := peer.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case message.Type == MessageTypeVersion && version == nil:
+			version = &VersionMessage{}
+			if err := json.Unmarshal(message.Data, version); err != nil {
+				return fmt.Errorf("invalid version data: %v", err)
+			}
+			if err := n.checkVersion(peer, version); err != nil {
+				return err
+			}
+			n.sendMessage(peer, MessageTypeVerack, VerackMessage{})
+		case message.Type == MessageTypeVerack && version != nil:
+			peer.maxPayload = MaxMessageSize
+			n.acceptVersion(peer, version)
+			return nil
+		default:
+			return fmt.Errorf("unexpected %s message during handshake", message.Type)
+		}
+	}
+}
+
+// checkVersion decides whether a peer may stay connected. On an encrypted
+// connection the peer's node ID must be the identity it proved, so that a
+// peer cannot claim another node's ID.
+func (n *Node) checkVersion(peer *Peer, version *VersionMessage) error {
+	if version.ProtocolVersion < MinProtocolVersion {
+		return fmt.Errorf("protocol version %d is older than the minimum %d", version.ProtocolVersion, MinProtocolVersion)
+	}
+	if version.GenesisHash != n.genesisHash() {
+		return fmt.Errorf("peer is on a different genesis %s", version.GenesisHash)
+	}
+	if version.NodeID == "" {
+		return fmt.Errorf("peer did not advertise a node ID")
+	}
+	if peer.Encrypted && version.NodeID != peer.Identity {
+		return fmt.Errorf("node ID %s does not match identity %s", version.NodeID, peer.Identity)
+	}
+	// Two nodes with identities always encrypt, so a plaintext connection
+	// between them means the transport hellos were tampered with
+	if !peer.Encrypted && n.identity != nil && version.Services&ServiceEncryption != 0 {
+		return fmt.Errorf("peer has an identity but the connection is not encrypted")
+	}
+	if version.NodeID == n.config.NodeID {
+		return errSelfConnection
+	}
+	if n.hasPeerID(version.NodeID) {
+		return fmt.Errorf("already connected to node %s", version.NodeID)
+	}
+	return nil
+}
+
+// services returns the services this node advertises
+func (n *Node) services() uint64 {
+	if n.identity != nil {
+		return localServices | ServiceEncryption
+	}
+	return localServices
+}
+
+// genesisHash returns the hash of the first block of our chain
+func (n *Node) genesisHash() string {
+	return n.blockchain.GetBlockByIndex(0).Hash
+}
+
+// acceptVersion records what a peer advertised in its version message
+func (n *Node) acceptVersion(peer *Peer, version *VersionMessage) {
+	peer.ID = version.NodeID
+	peer.ProtocolVersion = min(version.ProtocolVersion, ProtocolVersion)
+	peer.UserAgent = version.UserAgent
+	peer.Services = version.Services
+	peer.StartHeight = version.Height
+	peer.ListenAddress = listenAddress(peer.Address, version.ListenAddress)
+
+	peer.keepalive.setBest(version.Height, "")
+	n.syncer.updatePeerHeight(peer, version.Height)
+	transport := "plaintext"
+	if peer.Encrypted {
+		transport = "encrypted, identity " + peer.Identity
+	}
+	fmt.Printf("🤝 Handshake with %s (%s, %s, height %d, %s)\n",
+		peer.Address, peer.ID, peer.UserAgent, peer.StartHeight, transport)
+}
+
+// listenAddress returns the address a peer accepts connections on. A peer
+// listening on all interfaces is reached at the host it connected from.
+func listenAddress(remoteAddress, advertised string) string {
+	host, port, err := net.SplitHostPort(advertised)
+	if err != nil {
+		return ""
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		remoteHost, _, err := net.SplitHostPort(remoteAddress)
+		if err != nil {
+			return ""
+		}
+		host = remoteHost
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// HasService reports whether the peer advertised a service
+func (p *Peer) HasService(service uint64) bool {
+	return p.Services&service != 0
+}
@@ -0,0 +1,283 @@
+package network
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"aetherchain/blockchain"
+)
+
+// Inventory gossip. New blocks and transactions are announced by hash with
+// an inv message and only fetched with getdata by peers that do not have
+// them yet. Each peer remembers what it has sent or been sent, so an item
+// crosses a link at most once, and the node remembers what it recently
+// accepted so that echoes of it are ignored.
+const (
+	// MaxInvPerMessage bounds the items of an inv, getdata or notfound message
+	MaxInvPerMessage = 1000
+
+	maxKnownInventory  = 5000             // Items remembered per peer
+	maxRecentInventory = 50000            // Items remembered as recently accepted
+	getDataTimeout     = 30 * time.Second // Before an item is requested again
+)
+
+// InvType is the kind of an inventory item
+type InvType string
+
+const (
+	InvTypeBlock InvType = "block"
+	InvTypeTx    InvType = "tx"
+)
+
+// InvItem identifies a block or transaction by hash
+type InvItem struct {
+	Type InvType `json:"type"`
+	Hash string  `json:"hash"`
+}
+
+// InvMessage data announcing items the sender has
+type InvMessage struct {
+	Items []InvItem `json:"items"`
+}
+
+// GetDataMessage data requesting announced items, answered with a new_block
+// or new_tx message per item
+type GetDataMessage struct {
+	Items []InvItem `json:"items"`
+}
+
+// NotFoundMessage data for requested items the sender no longer has
+type NotFoundMessage struct {
+	Items []InvItem `json:"items"`
+}
+
+// inventorySet is a bounded set of inventory items that forgets the least
+// recently added item when full
+type inventorySet struct {
+	mutex    sync.Mutex
+	capacity int
+	order    *list.List // Most recently added first
+	items    map[InvItem]*list.Element
+}
+
+func newInventorySet(capacity int) *inventorySet {
+	return &inventorySet{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[InvItem]*list.Element),
+	}
+}
+
+// add inserts an item, or refreshes it if present, and reports whether it
+// was new
+func (s *inventorySet) add(item InvItem) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if element, exists := s.items[item]; exists {
+		s.order.MoveToFront(element)
+		return false
+	}
+	s.items[item] = s.order.PushFront(item)
+	if s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(InvItem))
+	}
+	return true
+}
+
+// contains reports whether an item is in the set
+func (s *inventorySet) contains(item InvItem) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, exists := s.items[item]
+	return exists
+}
+
+// RelayBlock announces an accepted block to every peer not known to have it
+func (n *Node) RelayBlock(block *blockchain.Block) {
+	n.relayInventory(InvItem{Type: InvTypeBlock, Hash: block.Hash})
+}
+
+// RelayTransaction announces an accepted transaction to every peer not
+// known to have it
+func (n *Node) RelayTransaction(tx *blockchain.Transaction) {
+	n.relayInventory(InvItem{Type: InvTypeTx, Hash: tx.Hash})
+}
+
+// relayInventory records an item as accepted and sends an inv for it to
+// the peers that have not sent or been sent it yet
+func (n *Node) relayInventory(item InvItem) {
+	n.recentInventory.add(item)
+	for _, peer := range n.connectedPeers() {
+		if peer.knownInventory.add(item) {
+			n.sendMessage(peer, MessageTypeInv, InvMessage{Items: []InvItem{item}})
+		}
+	}
+}
+
+// inventoryRequest is an item requested from a peer with getdata
+type inventoryRequest struct {
+	peerID string
+	sent   time.Time
+}
+
+// haveInventory reports whether an item was recently accepted or is stored,
+// either waiting in the pool or confirmed on the main chain
+func (n *Node) haveInventory(item InvItem) bool {
+	if n.recentInventory.contains(item) {
+		return true
+	}
+	switch item.Type {
+	case InvTypeBlock:
+		return n.blockchain.HaveBlock(item.Hash)
+	case InvTypeTx:
+		return n.blockchain.GetPendingTransaction(item.Hash) != nil || n.blockchain.HaveTransaction(item.Hash)
+	}
+	return false
+}
+
+// requestInventory marks an item as requested from a peer and reports
+// whether it may be requested, which it may not while an earlier request is
+// pending
+func (n *Node) requestInventory(peer *Peer, item InvItem) bool {
+	n.inventoryMutex.Lock()
+	defer n.inventoryMutex.Unlock()
+
+	if request, pending := n.requested[item]; pending && time.Since(request.sent) < getDataTimeout {
+		return false
+	}
+	n.requested[item] = inventoryRequest{peerID: peer.ID, sent: time.Now()}
+	return true
+}
+
+// inventoryReceived clears the pending request of an item and reports
+// whether the item was requested from the peer. A request to another peer
+// stays pending.
+func (n *Node) inventoryReceived(peer *Peer, item InvItem) bool {
+	n.inventoryMutex.Lock()
+	defer n.inventoryMutex.Unlock()
+
+	request, pending := n.requested[item]
+	if !pending || request.peerID != peer.ID {
+		return false
+	}
+	delete(n.requested, item)
+	return true
+}
+
+// pruneInventoryRequests drops requests that were never answered
+func (n *Node) pruneInventoryRequests() {
+	n.inventoryMutex.Lock()
+	defer n.inventoryMutex.Unlock()
+
+	for item, request := range n.requested {
+		if time.Since(request.sent) >= getDataTimeout {
+			delete(n.requested, item)
+		}
+	}
+}
+
+// decodeInventory decodes the items of an inv, getdata or notfound message,
+// penalizing the peer for malformed or oversized lists
+func (mh *MessageHandler) decodeInventory(peer *Peer, message *NetworkMessage) ([]InvItem, bool) {
+	var inv InvMessage
+	if err := json.Unmarshal(message.Data, &inv); err != nil {
+		mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("invalid %s data: %v", message.Type, err))
+		return nil, false
+	}
+	if len(inv.Items) > MaxInvPerMessage {
+		mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("%d items in one %s message", len(inv.Items), message.Type))
+		return nil, false
+	}
+	for _, item := range inv.Items {
+		if item.Type != InvTypeBlock && item.Type != InvTypeTx {
+			mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("unknown inventory type %s", item.Type))
+			return nil, false
+		}
+	}
+	return inv.Items, true
+}
+
+// handleInv requests the announced items we neither have nor already requested
+func (mh *MessageHandler) handleInv(peer *Peer, message *NetworkMessage) {
+	items, ok := mh.decodeInventory(peer, message)
+	if !ok {
+		return
+	}
+
+	var wanted []InvItem
+	for _, item := range items {
+		peer.knownInventory.add(item)
+		if mh.node.haveInventory(item) || !mh.node.requestInventory(peer, item) {
+			continue
+		}
+		wanted = append(wanted, item)
+	}
+
+	if len(wanted) > 0 {
+		mh.sendMessage(peer, MessageTypeGetData, GetDataMessage{Items: wanted})
+	}
+}
+
+// handleGetData sends the requested items, and a notfound for those we lack
+func (mh *MessageHandler) handleGetData(peer *Peer, message *NetworkMessage) {
+	items, ok := mh.decodeInventory(peer, message)
+	if !ok {
+		return
+	}
+
+	var missing []InvItem
+	for _, item := range items {
+		peer.knownInventory.add(item)
+		switch item.Type {
+		case InvTypeBlock:
+			block := mh.node.blockchain.GetBlock(item.Hash)
+			if block == nil {
+				missing = append(missing, item)
+				continue
+			}
+			data, err := block.Serialize()
+			if err != nil {
+				fmt.Printf("❌ Failed to encode block %d: %v\n", block.Index, err)
+				missing = append(missing, item)
+				continue
+			}
+			mh.sendMessage(peer, MessageTypeNewBlock, NewBlockMessage{Block: data})
+		case InvTypeTx:
+			tx := mh.node.blockchain.GetPendingTransaction(item.Hash)
+			if tx == nil {
+				missing = append(missing, item)
+				continue
+			}
+			data, err := tx.Serialize()
+			if err != nil {
+				fmt.Printf("❌ Failed to encode transaction %s: %v\n", tx.Hash, err)
+				missing = append(missing, item)
+				continue
+			}
+			mh.sendMessage(peer, MessageTypeNewTx, NewTxMessage{Transaction: data})
+		}
+	}
+
+	if len(missing) > 0 {
+		mh.sendMessage(peer, MessageTypeNotFound, NotFoundMessage{Items: missing})
+	}
+}
+
+// handleNotFound clears the requests a peer could not answer, so that the
+// items can be requested from the next peer announcing them
+func (mh *MessageHandler) handleNotFound(peer *Peer, message *NetworkMessage) {
+	items, ok := mh.decodeInventory(peer, message)
+	if !ok {
+		return
+	}
+	for _, item := range items {
+		mh.node.inventoryReceived(peer, item)
+	}
+}
@@ -0,0 +1,113 @@
+package network
+
+import (
+	"fmt"
+	mrand "math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Keepalive. Every connected peer is pinged at a fixed interval with a
+// random nonce that its pong must echo. The time until the matching pong
+// arrives is the peer's round-trip time, and a peer that leaves a ping
+// unanswered for too long is disconnected.
+const (
+	pingInterval = 10 * time.Second // Between pings to the same peer
+	pingTimeout  = 20 * time.Second // Before an unanswered ping disconnects the peer
+)
+
+// keepalive is a peer's ping state and the chain tip it last reported
+type keepalive struct {
+	mutex      sync.Mutex
+	nonce      uint64    // Nonce of the unanswered ping, 0 if none
+	sent       time.Time // When the unanswered ping was sent
+	rtt        time.Duration
+	bestHeight int
+	bestHash   string
+}
+
+// nextPing returns the nonce of a new ping, or false if a ping is still
+// unanswered
+func (k *keepalive) nextPing() (uint64, bool) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.nonce != 0 {
+		return 0, false
+	}
+	k.nonce = mrand.Uint64() | 1
+	k.sent = time.Now()
+	return k.nonce, true
+}
+
+// pong matches a pong to the unanswered ping and records the round-trip
+// time. It reports false if the nonce matches no ping.
+func (k *keepalive) pong(nonce uint64) bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if nonce == 0 || nonce != k.nonce {
+		return false
+	}
+	k.rtt = time.Since(k.sent)
+	k.nonce = 0
+	return true
+}
+
+// overdue reports whether a ping has been unanswered for longer than timeout
+func (k *keepalive) overdue(timeout time.Duration) bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.nonce != 0 && time.Since(k.sent) > timeout
+}
+
+// setBest records the chain tip the peer reported
+func (k *keepalive) setBest(height int, hash string) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.bestHeight = height
+	if hash != "" {
+		k.bestHash = hash
+	}
+}
+
+// status returns the round-trip time and the last reported chain tip
+func (k *keepalive) status() (time.Duration, int, string) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.rtt, k.bestHeight, k.bestHash
+}
+
+// pingPeers disconnects peers with an overdue ping and pings the others
+// that have no ping outstanding
+func (n *Node) pingPeers() {
+	n.cleanupDeadPeers()
+
+	last := n.blockchain.GetLastBlock()
+	for _, peer := range n.connectedPeers() {
+		nonce, ok := peer.keepalive.nextPing()
+		if !ok {
+			continue
+		}
+		n.sendMessage(peer, MessageTypePing, PingMessage{
+			Nonce:    nonce,
+			Height:   last.Index,
+			BestHash: last.Hash,
+		})
+	}
+}
+
+// cleanupDeadPeers disconnects peers that did not answer a ping in time.
+// Closing the connection makes the peer's read loop exit, which removes
+// the peer.
+func (n *Node) cleanupDeadPeers() {
+	for _, peer := range n.connectedPeers() {
+		if peer.keepalive.overdue(pingTimeout) {
+			peer.Conn.Close()
+			fmt.Printf("🧹 Removed dead peer %s: no pong within %s\n", peer.Address, pingTimeout)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package network
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"aetherchain/blockchain"
@@ -12,14 +14,21 @@ import (
 type MessageType string
 
 const (
-	MessageTypePing      MessageType = "ping"
-	MessageTypePong      MessageType = "pong"
-	MessageTypeGetBlocks MessageType = "get_blocks"
-	MessageTypeBlocks    MessageType = "blocks"
-	MessageTypeNewBlock  MessageType = "new_block"
-	MessageTypeNewTx     MessageType = "new_tx"
-	MessageTypeGetPeers  MessageType = "get_peers"
-	MessageTypePeers     MessageType = "peers"
+	MessageTypeVersion    MessageType = "version"
+	MessageTypeVerack     MessageType = "verack"
+	MessageTypePing       MessageType = "ping"
+	MessageTypePong       MessageType = "pong"
+	MessageTypeGetBlocks  MessageType = "get_blocks"
+	MessageTypeBlocks     MessageType = "blocks"
+	MessageTypeGetHeaders MessageType = "get_headers"
+	MessageTypeHeaders    MessageType = "headers"
+	MessageTypeNewBlock   MessageType = "new_block"
+	MessageTypeNewTx      MessageType = "new_tx"
+	MessageTypeInv        MessageType = "inv"
+	MessageTypeGetData    MessageType = "getdata"
+	MessageTypeNotFound   MessageType = "notfound"
+	MessageTypeGetPeers   MessageType = "get_peers"
+	MessageTypePeers      MessageType = "peers"
 )
 
 // NetworkMessage represents a message sent between nodes
@@ -31,34 +40,58 @@ type NetworkMessage struct {
 	Version   string         `json:"version"`
 }
 
-// PingMessage data for ping messages
+// PingMessage data for ping messages. Height is the index of the sender's
+// tip, as in the version message.
 type PingMessage struct {
+	Nonce     uint64 `json:"nonce"`
 	Height    int    `json:"height"`
 	BestHash  string `json:"best_hash"`
 }
 
-// PongMessage data for pong messages
+// PongMessage data for pong messages, echoing the nonce of the ping
 type PongMessage struct {
+	Nonce     uint64 `json:"nonce"`
 	Height    int    `json:"height"`
 	BestHash  string `json:"best_hash"`
 }
 
-// BlocksMessage data for sending blocks
+// GetBlocksMessage data for requesting blocks, either by hash or as the range
+// of main chain blocks following the fork point found with a block locator,
+// up to StopHash or MaxBlocksPerMessage blocks
+type GetBlocksMessage struct {
+	Hashes   []string `json:"hashes,omitempty"`
+	Locator  []string `json:"locator,omitempty"`
+	StopHash string   `json:"stop_hash,omitempty"`
+}
+
+// GetHeadersMessage data for requesting the main chain headers following the
+// fork point found with a block locator, up to StopHash or MaxHeadersPerMessage
+type GetHeadersMessage struct {
+	Locator  []string `json:"locator"`
+	StopHash string   `json:"stop_hash,omitempty"`
+}
+
+// HeadersMessage data for sending headers in their canonical binary encoding
+type HeadersMessage struct {
+	Headers [][]byte `json:"headers"`
+}
+
+// BlocksMessage data for sending blocks, each in its canonical binary encoding
 type BlocksMessage struct {
-	Blocks []*blockchain.Block `json:"blocks"`
+	Blocks [][]byte `json:"blocks"`
 }
 
-// NewBlockMessage data for announcing new blocks
+// NewBlockMessage data for sending a block, announced with inv, in its canonical binary encoding
 type NewBlockMessage struct {
-	Block *blockchain.Block `json:"block"`
+	Block []byte `json:"block"`
 }
 
-// NewTxMessage data for announcing new transactions
+// NewTxMessage data for sending a transaction, announced with inv, in its canonical binary encoding
 type NewTxMessage struct {
-	Transaction *blockchain.Transaction `json:"transaction"`
+	Transaction []byte `json:"transaction"`
 }
 
-// PeersMessage data for exchanging peer information
+// PeersMessage data for exchanging the listen addresses of known peers
 type PeersMessage struct {
 	Peers []string `json:"peers"`
 }
@@ -76,17 +109,12 @@ func NewMessageHandler(node *Node) *MessageHandler {
 }
 
 // HandleMessage processes an incoming network message
-func (mh *MessageHandler) HandleMessage(peer *Peer, rawData []byte) {
-	var message NetworkMessage
-	err := json.Unmarshal(rawData, &message)
-	if err != nil {
-		fmt.Printf("❌ Failed to parse message from %s: %v\n", peer.Address, err)
-		return
-	}
-
+func (mh *MessageHandler) HandleMessage(peer *Peer, message *NetworkMessage) {
 	fmt.Printf("📨 Received %s message from %s\n", message.Type, peer.Address)
 
 	switch message.Type {
+	case MessageTypeVersion, MessageTypeVerack:
+		mh.node.misbehaving(peer, scoreUnexpected, fmt.Sprintf("%s message after handshake", message.Type))
 	case MessageTypePing:
 		mh.handlePing(peer, message)
 	case MessageTypePong:
@@ -95,170 +123,340 @@ func (mh *MessageHandler) HandleMessage(peer *Peer, rawData []byte) {
 		mh.handleGetBlocks(peer, message)
 	case MessageTypeBlocks:
 		mh.handleBlocks(peer, message)
+	case MessageTypeGetHeaders:
+		mh.handleGetHeaders(peer, message)
+	case MessageTypeHeaders:
+		mh.handleHeaders(peer, message)
 	case MessageTypeNewBlock:
 		mh.handleNewBlock(peer, message)
 	case MessageTypeNewTx:
 		mh.handleNewTx(peer, message)
+	case MessageTypeInv:
+		mh.handleInv(peer, message)
+	case MessageTypeGetData:
+		mh.handleGetData(peer, message)
+	case MessageTypeNotFound:
+		mh.handleNotFound(peer, message)
 	case MessageTypeGetPeers:
 		mh.handleGetPeers(peer, message)
 	case MessageTypePeers:
 		mh.handlePeers(peer, message)
 	default:
-		fmt.Printf("❌ Unknown message type: %s\n", message.Type)
+		mh.node.misbehaving(peer, scoreUnexpected, fmt.Sprintf("unknown message type %s", message.Type))
 	}
 }
 
 // handlePing processes ping messages
-func (mh *MessageHandler) handlePing(peer *Peer, message NetworkMessage) {
+func (mh *MessageHandler) handlePing(peer *Peer, message *NetworkMessage) {
 	var pingData PingMessage
 	if err := json.Unmarshal(message.Data, &pingData); err != nil {
-		fmt.Printf("❌ Invalid ping data: %v\n", err)
+		mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("invalid ping data: %v", err))
 		return
 	}
 
 	// Update peer information
-	peer.LastSeen = time.Now()
+	peer.LastSeen.Store(time.Now().UnixNano())
+	peer.keepalive.setBest(pingData.Height, pingData.BestHash)
+	mh.node.syncer.updatePeerHeight(peer, pingData.Height)
 
 	// Send pong response
+	last := mh.node.blockchain.GetLastBlock()
 	pongData := PongMessage{
-		Height:   len(mh.node.blockchain.Chain),
-		BestHash: mh.node.blockchain.GetLastBlock().Hash,
+		Nonce:    pingData.Nonce,
+		Height:   last.Index,
+		BestHash: last.Hash,
 	}
 
 	mh.sendMessage(peer, MessageTypePong, pongData)
 }
 
 // handlePong processes pong messages
-func (mh *MessageHandler) handlePong(peer *Peer, message NetworkMessage) {
+func (mh *MessageHandler) handlePong(peer *Peer, message *NetworkMessage) {
 	var pongData PongMessage
 	if err := json.Unmarshal(message.Data, &pongData); err != nil {
-		fmt.Printf("❌ Invalid pong data: %v\n", err)
+		mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("invalid pong data: %v", err))
+		return
+	}
+	if !peer.keepalive.pong(pongData.Nonce) {
+		fmt.Printf("⚠️ Ignoring pong from %s with unknown nonce %d\n", peer.Address, pongData.Nonce)
 		return
 	}
 
 	// Update peer information
-	peer.LastSeen = time.Now()
+	peer.LastSeen.Store(time.Now().UnixNano())
+	peer.keepalive.setBest(pongData.Height, pongData.BestHash)
+	mh.node.syncer.updatePeerHeight(peer, pongData.Height)
 
-	fmt.Printf("🏓 Pong from %s - Height: %d, Best Hash: %s\n", 
-		peer.Address, pongData.Height, pongData.BestHash[:16])
+	rtt, _, _ := peer.keepalive.status()
+	fmt.Printf("🏓 Pong from %s - Height: %d, RTT: %s\n",
+		peer.Address, pongData.Height, rtt.Round(time.Microsecond))
 }
 
 // handleGetBlocks processes block requests
-func (mh *MessageHandler) handleGetBlocks(peer *Peer, message NetworkMessage) {
-	// For simplicity, send the entire chain
-	// In production, this would implement proper block synchronization
-	blocksData := BlocksMessage{
-		Blocks: mh.node.blockchain.Chain,
+func (mh *MessageHandler) handleGetBlocks(peer *Peer, message *NetworkMessage) {
+	var request GetBlocksMessage
+	if len(message.Data) > 0 {
+		if err := json.Unmarshal(message.Data, &request); err != nil {
+			mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("invalid get blocks data: %v", err))
+			return
+		}
+	}
+
+	// Send the requested blocks, or the range following the locator
+	var blocks []*blockchain.Block
+	if len(request.Hashes) > 0 {
+		for _, hash := range request.Hashes[:min(len(request.Hashes), MaxBlocksPerMessage)] {
+			if block := mh.node.blockchain.GetBlock(hash); block != nil {
+				blocks = append(blocks, block)
+			}
+		}
+	} else {
+		blocks = mh.node.blockchain.LocateBlocks(request.Locator, request.StopHash, MaxBlocksPerMessage)
+	}
+
+	blocksData := BlocksMessage{}
+	for _, block := range blocks {
+		data, err := block.Serialize()
+		if err != nil {
+			fmt.Printf("❌ Failed to encode block %d: %v\n", block.Index, err)
+			return
+		}
+		blocksData.Blocks = append(blocksData.Blocks, data)
 	}
 
 	mh.sendMessage(peer, MessageTypeBlocks, blocksData)
 }
 
-// handleBlocks processes incoming blocks
-func (mh *MessageHandler) handleBlocks(peer *Peer, message NetworkMessage) {
+// handleBlocks processes blocks sent in answer to get_blocks. Only blocks
+// the syncer queued or an orphan ancestor request asked the peer for are
+// accepted; any other block is unexpected and ends processing of the message.
+func (mh *MessageHandler) handleBlocks(peer *Peer, message *NetworkMessage) {
 	var blocksData BlocksMessage
 	if err := json.Unmarshal(message.Data, &blocksData); err != nil {
-		fmt.Printf("❌ Invalid blocks data: %v\n", err)
+		mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("invalid blocks data: %v", err))
 		return
 	}
 
 	fmt.Printf("📦 Received %d blocks from %s\n", len(blocksData.Blocks), peer.Address)
 
 	// Process received blocks
-	for _, block := range blocksData.Blocks {
-		if mh.node.blockchain.IsValidBlock(block) {
-			mh.node.blockchain.AddBlock(block)
-			fmt.Printf("✅ Added block %d to chain\n", block.Index)
+	for _, data := range blocksData.Blocks {
+		block, err := blockchain.DeserializeBlock(data)
+		if err != nil {
+			mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("undecodable block: %v", err))
+			return
+		}
+		peer.knownInventory.add(InvItem{Type: InvTypeBlock, Hash: block.Hash})
+		// Blocks requested during synchronization are connected in header order
+		if mh.node.syncer.deliverBlock(peer, block) {
+			continue
+		}
+		if !mh.node.inventoryReceived(peer, InvItem{Type: InvTypeBlock, Hash: block.Hash}) {
+			mh.node.misbehaving(peer, scoreUnexpected, fmt.Sprintf("unrequested block %s", block.Hash))
+			return
+		}
+		// Blocks on other branches are kept and may trigger a reorganization
+		if err := mh.node.blockchain.AddBlock(block); err != nil {
+			if errors.Is(err, blockchain.ErrOrphanBlock) {
+				mh.requestOrphanAncestors(peer, block)
+				continue
+			}
+			if !errors.Is(err, blockchain.ErrKnownBlock) {
+				mh.node.misbehaving(peer, scoreInvalidBlock, fmt.Sprintf("invalid block %d: %v", block.Index, err))
+			}
+			continue
+		}
+		fmt.Printf("✅ Added block %d to chain\n", block.Index)
+	}
+}
+
+// handleGetHeaders processes header requests
+func (mh *MessageHandler) handleGetHeaders(peer *Peer, message *NetworkMessage) {
+	var request GetHeadersMessage
+	if err := json.Unmarshal(message.Data, &request); err != nil {
+		mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("invalid get headers data: %v", err))
+		return
+	}
+
+	headers := mh.node.blockchain.LocateHeaders(request.Locator, request.StopHash, MaxHeadersPerMessage)
+	headersData := HeadersMessage{Headers: make([][]byte, 0, len(headers))}
+	for _, header := range headers {
+		data, err := header.Serialize()
+		if err != nil {
+			fmt.Printf("❌ Failed to encode header %d: %v\n", header.Index, err)
+			return
+		}
+		headersData.Headers = append(headersData.Headers, data)
+	}
+
+	mh.sendMessage(peer, MessageTypeHeaders, headersData)
+}
+
+// handleHeaders processes incoming headers
+func (mh *MessageHandler) handleHeaders(peer *Peer, message *NetworkMessage) {
+	var headersData HeadersMessage
+	if err := json.Unmarshal(message.Data, &headersData); err != nil {
+		mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("invalid headers data: %v", err))
+		return
+	}
+	if len(headersData.Headers) > MaxHeadersPerMessage {
+		mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("%d headers in one message", len(headersData.Headers)))
+		return
+	}
+
+	headers := make([]*blockchain.BlockHeader, 0, len(headersData.Headers))
+	for _, data := range headersData.Headers {
+		header, err := blockchain.DeserializeBlockHeader(data)
+		if err != nil {
+			mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("undecodable header: %v", err))
+			return
 		}
+		headers = append(headers, header)
+	}
+
+	if err := mh.node.syncer.handleHeaders(peer, headers); err != nil {
+		mh.node.misbehaving(peer, scoreInvalidBlock, fmt.Sprintf("rejected headers: %v", err))
 	}
 }
 
-// handleNewBlock processes new block announcements
-func (mh *MessageHandler) handleNewBlock(peer *Peer, message NetworkMessage) {
+// handleNewBlock processes blocks sent in answer to getdata. Blocks are only
+// announced with inv, so a block we did not request from the peer is
+// unexpected and dropped.
+func (mh *MessageHandler) handleNewBlock(peer *Peer, message *NetworkMessage) {
     var newBlockData NewBlockMessage
     if err := json.Unmarshal(message.Data, &newBlockData); err != nil {
-        fmt.Printf("❌ Invalid new block data: %v\n", err)
+        mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("invalid new block data: %v", err))
         return
     }
 
-    block := newBlockData.Block
-    fmt.Printf("🆕 New block announced from %s: Index=%d, Hash=%s\n", 
+    block, err := blockchain.DeserializeBlock(newBlockData.Block)
+    if err != nil {
+        mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("undecodable block: %v", err))
+        return
+    }
+    item := InvItem{Type: InvTypeBlock, Hash: block.Hash}
+    peer.knownInventory.add(item)
+    if !mh.node.inventoryReceived(peer, item) {
+        mh.node.misbehaving(peer, scoreUnexpected, fmt.Sprintf("unrequested block %s", block.Hash))
+        return
+    }
+    if mh.node.haveInventory(item) {
+        return
+    }
+    fmt.Printf("🆕 New block from %s: Index=%d, Hash=%s\n", 
         peer.Address, block.Index, block.Hash[:16])
-
-    // Validate and add the block
-    if mh.node.blockchain.IsValidBlock(block) {
-        mh.node.blockchain.AddBlock(block)
+    mh.node.syncer.updatePeerHeight(peer, block.Index)
+
+    // Validate and add the block, which may extend a side branch
+    err = mh.node.blockchain.AddBlock(block)
+    if errors.Is(err, blockchain.ErrOrphanBlock) {
+        // Keep the block until its ancestors arrive from the announcing peer
+        mh.requestOrphanAncestors(peer, block)
+    } else if err == nil {
         fmt.Printf("✅ Added new block %d to chain\n", block.Index)
-        
-        // Broadcast to other peers - درست شده:
-        broadcastData, _ := json.Marshal(message)
-        mh.node.BroadcastMessage(broadcastData)
-    } else {
-        fmt.Printf("❌ Invalid block received from %s\n", peer.Address)
+        mh.node.RelayBlock(block)
+    } else if !errors.Is(err, blockchain.ErrKnownBlock) {
+        mh.node.misbehaving(peer, scoreInvalidBlock, fmt.Sprintf("invalid block %d: %v", block.Index, err))
     }
 }
 
-// handleNewTx processes new transaction announcements
-func (mh *MessageHandler) handleNewTx(peer *Peer, message NetworkMessage) {
+// requestOrphanAncestors asks a peer for the missing ancestor of an orphan block.
+// Each ancestor that turns out to be an orphan itself triggers the next request.
+// The request is tracked like a getdata, so that only the peer asked may
+// answer it.
+func (mh *MessageHandler) requestOrphanAncestors(peer *Peer, block *blockchain.Block) {
+	missing := mh.node.blockchain.GetOrphanRoot(block.Hash)
+	if !mh.node.requestInventory(peer, InvItem{Type: InvTypeBlock, Hash: missing}) {
+		return
+	}
+	fmt.Printf("🔍 Block %d from %s is an orphan, requesting ancestor %s\n",
+		block.Index, peer.Address, missing)
+
+	mh.sendMessage(peer, MessageTypeGetBlocks, GetBlocksMessage{Hashes: []string{missing}})
+}
+
+// handleNewTx processes transactions sent in answer to getdata. Like
+// blocks, transactions we did not request from the peer are dropped.
+func (mh *MessageHandler) handleNewTx(peer *Peer, message *NetworkMessage) {
     var newTxData NewTxMessage
     if err := json.Unmarshal(message.Data, &newTxData); err != nil {
-        fmt.Printf("❌ Invalid new transaction data: %v\n", err)
+        mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("invalid new transaction data: %v", err))
         return
     }
 
-    tx := newTxData.Transaction
-    fmt.Printf("🆕 New transaction announced from %s: Hash=%s\n", 
+    tx, err := blockchain.DeserializeTransaction(newTxData.Transaction)
+    if err != nil {
+        mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("undecodable transaction: %v", err))
+        return
+    }
+    item := InvItem{Type: InvTypeTx, Hash: tx.Hash}
+    peer.knownInventory.add(item)
+    if !mh.node.inventoryReceived(peer, item) {
+        mh.node.misbehaving(peer, scoreUnexpected, fmt.Sprintf("unrequested transaction %s", tx.Hash))
+        return
+    }
+    if mh.node.haveInventory(item) {
+        return
+    }
+    fmt.Printf("🆕 New transaction from %s: Hash=%s\n", 
         peer.Address, tx.Hash[:16])
 
     // Validate and add the transaction
-    if tx.IsValid() {
-        mh.node.blockchain.AddTransaction(tx)
-        fmt.Printf("✅ Added transaction to pool: %s\n", tx.Hash[:16])
-        
-        // Broadcast to other peers - درست شده:
-        broadcastData, _ := json.Marshal(message)
-        mh.node.BroadcastMessage(broadcastData)
-    } else {
-        fmt.Printf("❌ Invalid transaction received from %s\n", peer.Address)
+    if !tx.IsValid() {
+        mh.node.misbehaving(peer, scoreInvalidTx, fmt.Sprintf("invalid transaction %s", tx.Hash))
+        return
     }
+    if err := mh.node.blockchain.AddTransaction(tx); err != nil {
+        // Conflicts with our pool or state are not the peer's fault
+        fmt.Printf("⚠️ Transaction %s not added to pool: %v\n", tx.Hash[:16], err)
+        return
+    }
+    fmt.Printf("✅ Added transaction to pool: %s\n", tx.Hash[:16])
+    mh.node.RelayTransaction(tx)
 }
 
 // handleGetPeers processes peer list requests
-func (mh *MessageHandler) handleGetPeers(peer *Peer, message NetworkMessage) {
-	// Send our peer list
-	peers := mh.node.GetPeerList()
+func (mh *MessageHandler) handleGetPeers(peer *Peer, message *NetworkMessage) {
+	// Send addresses from our address book
 	peersData := PeersMessage{
-		Peers: peers,
+		Peers: mh.node.discovery.book.Addresses(MaxAddrPerMessage),
 	}
 
 	mh.sendMessage(peer, MessageTypePeers, peersData)
 }
 
 // handlePeers processes incoming peer lists
-func (mh *MessageHandler) handlePeers(peer *Peer, message NetworkMessage) {
+func (mh *MessageHandler) handlePeers(peer *Peer, message *NetworkMessage) {
 	var peersData PeersMessage
 	if err := json.Unmarshal(message.Data, &peersData); err != nil {
-		fmt.Printf("❌ Invalid peers data: %v\n", err)
+		mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("invalid peers data: %v", err))
+		return
+	}
+	if len(peersData.Peers) > MaxAddrPerMessage {
+		mh.node.misbehaving(peer, scoreInvalidData, fmt.Sprintf("%d addresses in one peers message", len(peersData.Peers)))
 		return
 	}
 
 	fmt.Printf("👥 Received %d peers from %s\n", len(peersData.Peers), peer.Address)
 
-	// Connect to new peers
+	// Remember the addresses, discovery connects to them as slots free up
 	for _, peerAddr := range peersData.Peers {
-		if !mh.node.HasPeer(peerAddr) && peerAddr != mh.node.config.Host {
-			go mh.node.ConnectToNode(peerAddr)
-		}
+		mh.node.discovery.AddDiscoveredPeer(peerAddr, peer.host())
 	}
 }
 
 // sendMessage sends a message to a peer
 func (mh *MessageHandler) sendMessage(peer *Peer, msgType MessageType, data interface{}) {
+	mh.node.sendMessage(peer, msgType, data)
+}
+
+// sendMessage sends a message to a peer
+func (n *Node) sendMessage(peer *Peer, msgType MessageType, data interface{}) {
 	message := NetworkMessage{
 		Type:      msgType,
 		Timestamp: time.Now().Unix(),
-		NodeID:    mh.node.config.NodeID,
-		Version:   mh.node.config.Version,
+		NodeID:    n.config.NodeID,
+		Version:   n.config.Version,
 	}
 
 	jsonData, err := json.Marshal(data)
@@ -268,39 +466,66 @@ func (mh *MessageHandler) sendMessage(peer *Peer, msgType MessageType, data inte
 	}
 	message.Data = jsonData
 
-	rawMessage, err := json.Marshal(message)
-	if err != nil {
-		fmt.Printf("❌ Failed to marshal message: %v\n", err)
-		return
-	}
-
-	if peer.Connected {
-		_, err := peer.Conn.Write(rawMessage)
-		if err != nil {
-			fmt.Printf("❌ Failed to send message to %s: %v\n", peer.Address, err)
-		}
+	if err := peer.WriteMessage(&message); err != nil {
+		fmt.Printf("❌ Failed to send message to %s: %v\n", peer.Address, err)
 	}
 }
 
-// GetPeerList returns list of peer addresses
-func (n *Node) GetPeerList() []string {
-	n.peerMutex.RLock()
-	defer n.peerMutex.RUnlock()
+// PeerInfo describes a connected peer for the API
+type PeerInfo struct {
+	ID              string  `json:"id"`
+	Address         string  `json:"address"`
+	ListenAddress   string  `json:"listen_address"`
+	Outbound        bool    `json:"outbound"`
+	UserAgent       string  `json:"user_agent"`
+	ProtocolVersion uint32  `json:"protocol_version"`
+	Services        uint64  `json:"services"`
+	StartHeight     int     `json:"start_height"`
+	Height          int     `json:"height"`    // Tip height last reported in a ping or pong
+	BestHash        string  `json:"best_hash"` // Tip hash last reported in a ping or pong
+	RTTMillis       float64 `json:"rtt_ms"`    // Round-trip time of the last answered ping
+	Encrypted       bool    `json:"encrypted"`
+	Identity        string  `json:"identity,omitempty"`
+	Misbehavior     int32   `json:"misbehavior"`
+	LastSeen        int64   `json:"last_seen"`
+}
 
-	var peers []string
-	for _, peer := range n.peers {
-		peers = append(peers, peer.Address)
+// GetPeerList returns details of every connected peer
+func (n *Node) GetPeerList() []PeerInfo {
+	peers := n.connectedPeers()
+	infos := make([]PeerInfo, 0, len(peers))
+	for _, peer := range peers {
+		rtt, height, bestHash := peer.keepalive.status()
+		infos = append(infos, PeerInfo{
+			ID:              peer.ID,
+			Address:         peer.Address,
+			ListenAddress:   peer.ListenAddress,
+			Outbound:        peer.Outbound,
+			UserAgent:       peer.UserAgent,
+			ProtocolVersion: peer.ProtocolVersion,
+			Services:        peer.Services,
+			StartHeight:     peer.StartHeight,
+			Height:          height,
+			BestHash:        bestHash,
+			RTTMillis:       float64(rtt) / float64(time.Millisecond),
+			Encrypted:       peer.Encrypted,
+			Identity:        peer.Identity,
+			Misbehavior:     peer.misbehavior.Load(),
+			LastSeen:        time.Unix(0, peer.LastSeen.Load()).Unix(),
+		})
 	}
-	return peers
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
 }
 
-// HasPeer checks if we're already connected to a peer
+// HasPeer checks if we're already connected to a peer, by the address we
+// know it by or the address it listens on
 func (n *Node) HasPeer(address string) bool {
 	n.peerMutex.RLock()
 	defer n.peerMutex.RUnlock()
 
 	for _, peer := range n.peers {
-		if peer.Address == address {
+		if peer.Address == address || peer.ListenAddress == address {
 			return true
 		}
 	}
@@ -1,13 +1,18 @@
 package network
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"aetherchain/config"
 	"aetherchain/blockchain"
+	"aetherchain/crypto"
+	"aetherchain/storage"
 )
 
 // Node represents a network node in the AetherChain network
@@ -19,33 +24,116 @@ type Node struct {
 	listener   net.Listener
 	peers      map[string]*Peer
 	peerMutex  sync.RWMutex
+	syncer      *Syncer
+	discovery   *PeerDiscovery
+	connManager *ConnManager
+	
+	magic      uint32 // Network magic prefixed to every message frame
+	identity   *crypto.KeyPair // Transport identity, nil when encryption is off
+	
+	// Inventory gossip, see inventory.go
+	recentInventory *inventorySet                // Items recently accepted and relayed
+	requested       map[InvItem]inventoryRequest // Items requested with getdata
+	inventoryMutex  sync.Mutex
+	
+	// Banned hosts by IP address
+	bans       map[string]storage.BanEntry
+	banStore   BanStore
+	banMutex   sync.Mutex
 	
 	// Node state
-	isRunning  bool
+	isRunning  atomic.Bool
 	stopCh     chan struct{}
+	stopOnce   sync.Once
 }
 
 // Peer represents a connected peer node
 type Peer struct {
-	ID        string
+	ID        string // Node ID advertised in the handshake
 	Address   string
 	Conn      net.Conn
-	Connected bool
-	LastSeen  time.Time
+	Connected atomic.Bool
+	Outbound  bool         // Whether we dialed the peer
+	LastSeen  atomic.Int64 // Unix nanoseconds of the last message received
+	
+	// Advertised in the version handshake
+	ProtocolVersion uint32 // Negotiated protocol version
+	UserAgent       string
+	Services        uint64
+	StartHeight     int
+	ListenAddress   string // Address the peer accepts connections on
+	
+	// Verified on encrypted connections, empty otherwise
+	Encrypted   bool
+	IdentityKey string // Hex-encoded identity public key
+	Identity    string // Address derived from the identity public key
+	
+	misbehavior atomic.Int32 // Misbehavior score, see misbehaving
+	limiter     rateLimiter  // Incoming message rate, used by the read loop only
+	
+	knownInventory *inventorySet // Items the peer sent or was sent
+	keepalive      keepalive     // Ping state and reported chain tip
+	
+	magic      uint32
+	maxPayload uint32        // Payload limit, raised once the handshake completes
+	reader     *bufio.Reader // Buffers Conn for reading message frames
+	writeMutex sync.Mutex    // Serializes message frames written to Conn
+}
+
+// newPeer wraps a connection speaking the given network's protocol
+func newPeer(conn net.Conn, address string, magic uint32) *Peer {
+	peer := &Peer{
+		ID:         generatePeerID(),
+		Address:    address,
+		Conn:       conn,
+		magic:      magic,
+		maxPayload: maxHandshakeMessageSize,
+		reader:     bufio.NewReader(conn),
+		
+		knownInventory: newInventorySet(maxKnownInventory),
+	}
+	peer.Connected.Store(true)
+	peer.LastSeen.Store(time.Now().UnixNano())
+	return peer
 }
 
 // NewNode creates a new network node
 func NewNode(cfg *config.Config, bc *blockchain.Blockchain) *Node {
-	return &Node{
+	node := &Node{
 		config:     cfg,
 		blockchain: bc,
 		peers:      make(map[string]*Peer),
+		magic:      magicForEnvironment(cfg.Environment),
+		bans:       make(map[string]storage.BanEntry),
+		
+		recentInventory: newInventorySet(maxRecentInventory),
+		requested:       make(map[InvItem]inventoryRequest),
+		
 		stopCh:     make(chan struct{}),
 	}
+	node.syncer = NewSyncer(node)
+	node.discovery = NewPeerDiscovery(node)
+	node.connManager = NewConnManager(node)
+	return node
 }
 
 // Start begins listening for incoming connections
 func (n *Node) Start() error {
+	if n.config.P2PEncryption || n.config.P2PRequireEncryption {
+		identity, persistent, err := loadNodeIdentity(n.config)
+		if err != nil {
+			return fmt.Errorf("failed to load node identity: %v", err)
+		}
+		// Pinned deployments rely on identities that survive a restart
+		if !persistent && hasPinnedPeer(n.config.BootstrapNodes) {
+			return fmt.Errorf("bootstrap nodes pin identities but the node identity is not persistent, set an identity passphrase")
+		}
+		n.identity = identity
+		// Peers check that our node ID is the identity we prove
+		n.config.NodeID = identity.Address
+		fmt.Printf("🔐 Node identity: %s\n", identity.Address)
+	}
+	
 	address := fmt.Sprintf("%s:%d", n.config.Host, n.config.Port)
 	
 	listener, err := net.Listen("tcp", address)
@@ -54,199 +142,263 @@ func (n *Node) Start() error {
 	}
 	
 	n.listener = listener
-	n.isRunning = true
+	n.isRunning.Store(true)
 	
 	fmt.Printf("🔌 Node listening on %s\n", address)
 	
 	// Start accepting connections
-	go n.acceptConnections()
+	n.connManager.goroutine(n.acceptConnections)
 	
-	// Connect to bootstrap nodes
-	go n.connectToBootstrapNodes()
+	// Keep bootstrap nodes connected and discover further peers
+	for _, bootstrapNode := range n.config.BootstrapNodes {
+		if err := n.AddPersistentPeer(bootstrapNode); err != nil {
+			fmt.Printf("❌ Invalid bootstrap node: %v\n", err)
+		}
+	}
+	n.connManager.goroutine(func() { n.connManager.run(n.stopCh) })
+	n.connManager.goroutine(func() { n.discovery.run(n.stopCh) })
 	
 	// Start peer maintenance
-	go n.peerMaintenance()
+	n.connManager.goroutine(n.peerMaintenance)
+	
+	// Start chain synchronization
+	n.connManager.goroutine(func() { n.syncer.run(n.stopCh) })
 	
 	return nil
 }
 
-// Stop gracefully shuts down the node
+// Stop gracefully shuts down the node. It closes every connection and
+// returns once all peer and background goroutines have finished.
 func (n *Node) Stop() {
-	n.isRunning = false
-	close(n.stopCh)
-	
-	if n.listener != nil {
-		n.listener.Close()
-	}
-	
-	// Close all peer connections
-	n.peerMutex.Lock()
-	for _, peer := range n.peers {
-		if peer.Conn != nil {
-			peer.Conn.Close()
+	n.stopOnce.Do(func() {
+		n.isRunning.Store(false)
+		close(n.stopCh)
+		
+		if n.listener != nil {
+			n.listener.Close()
 		}
-	}
-	n.peers = make(map[string]*Peer)
-	n.peerMutex.Unlock()
-	
-	fmt.Println("🔌 Node stopped")
+		
+		// Close all connections and wait for their goroutines
+		n.connManager.stop()
+		
+		n.peerMutex.Lock()
+		n.peers = make(map[string]*Peer)
+		n.peerMutex.Unlock()
+		
+		n.discovery.save()
+		
+		fmt.Println("🔌 Node stopped")
+	})
 }
 
 // acceptConnections handles incoming connections
 func (n *Node) acceptConnections() {
-	for n.isRunning {
+	for n.isRunning.Load() {
 		conn, err := n.listener.Accept()
 		if err != nil {
-			if n.isRunning {
+			if n.isRunning.Load() {
 				fmt.Printf("Error accepting connection: %v\n", err)
 			}
 			continue
 		}
 		
-		go n.handleConnection(conn)
+		if !n.connManager.reserveInbound() {
+			fmt.Printf("❌ Refused connection from %s: all %d inbound slots are in use\n",
+				conn.RemoteAddr(), n.config.MaxInboundPeers)
+			conn.Close()
+			continue
+		}
+		if !n.connManager.goroutine(func() { n.handleConnection(conn) }) {
+			n.connManager.releaseInbound()
+			conn.Close()
+		}
 	}
 }
 
 // handleConnection processes a new connection
 func (n *Node) handleConnection(conn net.Conn) {
+    defer n.connManager.releaseInbound()
+    if !n.connManager.track(conn) {
+        return
+    }
+    defer n.connManager.untrack(conn)
+    
     peerAddress := conn.RemoteAddr().String()
     fmt.Printf("🔗 New connection from %s\n", peerAddress)
+    
+    if err := n.checkConnectionLimits(peerAddress); err != nil {
+        fmt.Printf("❌ Refused connection from %s: %v\n", peerAddress, err)
+        return
+    }
 
-    peer := &Peer{
-        ID:        generatePeerID(),
-        Address:   peerAddress,
-        Conn:      conn,
-        Connected: true,
-        LastSeen:  time.Now(),
+    peer, err := n.setupPeer(conn, peerAddress, false)
+    if err != nil {
+        return
     }
+    
+    n.handlePeerCommunication(peer)
+}
 
-    n.addPeer(peer)
+// connectOutbound dials a node and serves the connection until it closes.
+// The caller has reserved an outbound slot for the address.
+func (n *Node) connectOutbound(address string) {
+    defer n.connManager.releaseOutbound(address)
     
-    // Handle peer communication - درست شده:
+    n.discovery.book.Attempt(address)
+    dialer := net.Dialer{Timeout: n.config.PeerTimeout}
+    conn, err := dialer.DialContext(n.connManager.ctx, "tcp", address)
+    if err != nil {
+        fmt.Printf("Failed to connect to node %s: %v\n", address, err)
+        n.connManager.connectFailed(address, err)
+        return
+    }
+    if !n.connManager.track(conn) {
+        return
+    }
+    defer n.connManager.untrack(conn)
+    
+    fmt.Printf("🔗 Connected to node %s\n", address)
+    
+    if n.isBanned(conn.RemoteAddr().String()) {
+        fmt.Printf("❌ Not connecting to banned node %s\n", address)
+        n.connManager.connectFailed(address, fmt.Errorf("node is banned"))
+        return
+    }
+    
+    peer, err := n.setupPeer(conn, address, true)
+    if err != nil {
+        n.connManager.connectFailed(address, err)
+        return
+    }
+    n.connManager.connected(address)
     n.handlePeerCommunication(peer)
+    n.connManager.disconnected(address)
+}
+
+// setupPeer negotiates the transport, checks the identity of a pinned
+// persistent peer, performs the handshake and registers the peer. The
+// connection is closed if any step fails.
+func (n *Node) setupPeer(conn net.Conn, address string, outbound bool) (*Peer, error) {
+    transport, identity, err := n.secureTransport(conn, outbound)
+    if err == nil && outbound {
+        err = n.connManager.checkIdentity(address, identity)
+    }
+    if err != nil {
+        fmt.Printf("❌ Rejected peer %s: %v\n", address, err)
+        conn.Close()
+        return nil, err
+    }
+    
+    peer := newPeer(transport, address, n.magic)
+    peer.Outbound = outbound
+    if identity != nil {
+        peer.Encrypted = true
+        peer.IdentityKey = identity.publicKey
+        peer.Identity = identity.address
+    }
+    
+    err = n.handshake(peer)
+    if err == nil {
+        err = n.addPeer(peer)
+    }
+    if err != nil {
+        fmt.Printf("❌ Rejected peer %s: %v\n", address, err)
+        peer.Connected.Store(false)
+        conn.Close()
+        return nil, err
+    }
+    n.discovery.peerConnected(peer)
+    return peer, nil
 }
 
 // handlePeerCommunication manages communication with a peer
 func (n *Node) handlePeerCommunication(peer *Peer) {
     defer func() {
-        peer.Connected = false
+        peer.Connected.Store(false)
         if peer.Conn != nil {
             peer.Conn.Close()
         }
-        n.removePeer(peer.ID)
+        n.removePeer(peer)
         fmt.Printf("🔌 Disconnected from peer %s\n", peer.Address)
     }()
 
-    buffer := make([]byte, 4096)
-    
-    for n.isRunning && peer.Connected {  // درست شده: n.isRunning
+    messageHandler := NewMessageHandler(n)
+    for n.isRunning.Load() && peer.Connected.Load() {
         // Set read timeout
         peer.Conn.SetReadDeadline(time.Now().Add(30 * time.Second))
         
-        bytesRead, err := peer.Conn.Read(buffer)
+        message, err := peer.ReadMessage()
+        if errors.Is(err, ErrProtocolViolation) {
+            n.misbehaving(peer, scoreMalformedMessage, err.Error())
+            return
+        }
         if err != nil {
-            if n.isRunning {  // درست شده
+            if n.isRunning.Load() {
                 fmt.Printf("Error reading from peer %s: %v\n", peer.Address, err)
             }
             return
         }
         
-        if bytesRead > 0 {
-            peer.LastSeen = time.Now()
-            // درست شده: استفاده از MessageHandler
-            messageHandler := NewMessageHandler(n)
-            messageHandler.HandleMessage(peer, buffer[:bytesRead])
+        peer.LastSeen.Store(time.Now().UnixNano())
+        if !peer.limiter.allow(n.config.MaxMessageRate, n.config.MaxMessageBurst) {
+            n.misbehaving(peer, scoreRateLimited, "message rate limit exceeded, dropped "+string(message.Type))
+            continue
         }
+        messageHandler.HandleMessage(peer, message)
     }
 }
 
-// handleMessage processes incoming messages from peers
-func (n *Node) handleMessage(peer *Peer, data []byte) {
-	// Parse and handle different message types
-	// This is a simplified implementation
-	fmt.Printf("📨 Received message from %s: %s\n", peer.Address, string(data))
-	
-	// Echo back for now
-	response := fmt.Sprintf("Echo: %s", string(data))
-	peer.Conn.Write([]byte(response))
-}
-
-// connectToNode attempts to connect to a specific node
-func (n *Node) ConnectToNode(address string) {
-    conn, err := net.DialTimeout("tcp", address, n.config.PeerTimeout)
-    if err != nil {
-        fmt.Printf("Failed to connect to node %s: %v\n", address, err)
-        return
-    }
-    
-    fmt.Printf("🔗 Connected to node %s\n", address)
-    
-    peer := &Peer{
-        ID:        generatePeerID(),
-        Address:   address,
-        Conn:      conn,
-        Connected: true,
-        LastSeen:  time.Now(),
-    }
-    
-    n.addPeer(peer)
-    go n.handlePeerCommunication(peer)
-}
-
-// connectToBootstrapNodes connects to bootstrap nodes
-func (n *Node) connectToBootstrapNodes() {
-	for _, bootstrapNode := range n.config.BootstrapNodes {
-		go n.ConnectToNode(bootstrapNode)
-	}
-}
-
 // peerMaintenance performs maintenance tasks on peers
 func (n *Node) peerMaintenance() {
-	ticker := time.NewTicker(60 * time.Second)
+	ticker := time.NewTicker(pingInterval)
 	defer ticker.Stop()
 	
 	for {
 		select {
 		case <-ticker.C:
-			n.cleanupDeadPeers()
+			n.pingPeers()
+			n.pruneInventoryRequests()
 		case <-n.stopCh:
 			return
 		}
 	}
 }
 
-// cleanupDeadPeers removes peers that haven't been seen recently
-func (n *Node) cleanupDeadPeers() {
+// addPeer adds a peer to the peer list
+func (n *Node) addPeer(peer *Peer) error {
 	n.peerMutex.Lock()
 	defer n.peerMutex.Unlock()
 	
-	for id, peer := range n.peers {
-		if time.Since(peer.LastSeen) > n.config.PeerTimeout {
-			if peer.Conn != nil {
-				peer.Conn.Close()
-			}
-			delete(n.peers, id)
-			fmt.Printf("🧹 Removed dead peer: %s\n", peer.Address)
-		}
+	if _, exists := n.peers[peer.ID]; exists {
+		return fmt.Errorf("already connected to node %s", peer.ID)
 	}
+	n.peers[peer.ID] = peer
+	fmt.Printf("👥 Added peer: %s (Total: %d)\n", peer.Address, len(n.peers))
+	return nil
 }
 
-// addPeer adds a peer to the peer list
-func (n *Node) addPeer(peer *Peer) {
-	n.peerMutex.Lock()
-	defer n.peerMutex.Unlock()
+// hasPeerID checks if we're already connected to a node
+func (n *Node) hasPeerID(id string) bool {
+	n.peerMutex.RLock()
+	defer n.peerMutex.RUnlock()
 	
-	n.peers[peer.ID] = peer
-	fmt.Printf("👥 Added peer: %s (Total: %d)\n", peer.Address, len(n.peers))
+	_, exists := n.peers[id]
+	return exists
 }
 
-// removePeer removes a peer from the peer list
-func (n *Node) removePeer(peerID string) {
+// removePeer removes a peer from the peer list, unless the entry already
+// belongs to a newer connection to the same node
+func (n *Node) removePeer(peer *Peer) {
     n.peerMutex.Lock()
-    defer n.peerMutex.Unlock()
+    if n.peers[peer.ID] != peer {
+        n.peerMutex.Unlock()
+        return
+    }
+    delete(n.peers, peer.ID)
+    fmt.Printf("👋 Removed peer: %s (Total: %d)\n", peer.ID, len(n.peers))
+    n.peerMutex.Unlock()
     
-    delete(n.peers, peerID)
-    fmt.Printf("👋 Removed peer: %s (Total: %d)\n", peerID, len(n.peers))
+    n.syncer.removePeer(peer.ID)
 }
 
 // GetPeerCount returns the number of connected peers
@@ -257,19 +409,32 @@ func (n *Node) GetPeerCount() int {
 	return len(n.peers)
 }
 
-
-
-// BroadcastMessage sends a message to all connected peers
-func (n *Node) BroadcastMessage(message []byte) {
+// connectedPeers returns the peers with an open connection
+func (n *Node) connectedPeers() []*Peer {
 	n.peerMutex.RLock()
 	defer n.peerMutex.RUnlock()
 	
+	var peers []*Peer
 	for _, peer := range n.peers {
-		if peer.Connected {
-			_, err := peer.Conn.Write(message)
-			if err != nil {
-				fmt.Printf("Failed to send message to peer %s: %v\n", peer.Address, err)
-			}
+		if peer.Connected.Load() {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// GetSyncStatus returns the progress of chain synchronization
+func (n *Node) GetSyncStatus() SyncStatus {
+	return n.syncer.Status()
+}
+
+
+
+// BroadcastMessage sends a message to all connected peers
+func (n *Node) BroadcastMessage(message *NetworkMessage) {
+	for _, peer := range n.connectedPeers() {
+		if err := peer.WriteMessage(message); err != nil {
+			fmt.Printf("Failed to send message to peer %s: %v\n", peer.Address, err)
 		}
 	}
 }
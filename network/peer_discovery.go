@@ -2,59 +2,185 @@ package network
 
 import (
 	"fmt"
+	"net"
+	"strconv"
+	"sync"
 	"time"
+
+	"aetherchain/storage"
+)
+
+const (
+	discoveryInterval   = 10 * time.Second // Between checks of the outbound slots
+	addressPollInterval = 5 * time.Minute  // Between get_peers requests to connected peers
+	addressSaveInterval = 2 * time.Minute  // Between saves of the address book
 )
 
-// PeerDiscovery manages peer discovery and network connectivity
+// AddressStore persists the address book across restarts
+type AddressStore interface {
+	SavePeers(peers []storage.PeerAddress) error
+	LoadPeers() ([]storage.PeerAddress, error)
+}
+
+// PeerDiscovery manages peer discovery and network connectivity. It learns
+// addresses from the peers messages of connected peers and keeps the
+// configured number of outbound connections open to addresses from the
+// address book.
 type PeerDiscovery struct {
-	node    *Node
-	peers   map[string]time.Time // peer address -> last discovered
+	node  *Node
+	book  *AddressBook
+	store AddressStore
+	mutex sync.Mutex
 }
 
 // NewPeerDiscovery creates a new peer discovery instance
 func NewPeerDiscovery(node *Node) *PeerDiscovery {
 	return &PeerDiscovery{
-		node:  node,
-		peers: make(map[string]time.Time),
+		node: node,
+		book: NewAddressBook(),
+	}
+}
+
+// run fills the outbound slots, polls peers for addresses and saves the
+// address book until stopCh is closed
+func (pd *PeerDiscovery) run(stopCh <-chan struct{}) {
+	fillTicker := time.NewTicker(discoveryInterval)
+	defer fillTicker.Stop()
+	pollTicker := time.NewTicker(addressPollInterval)
+	defer pollTicker.Stop()
+	saveTicker := time.NewTicker(addressSaveInterval)
+	defer saveTicker.Stop()
+
+	pd.fillOutboundSlots()
+	for {
+		select {
+		case <-fillTicker.C:
+			pd.fillOutboundSlots()
+		case <-pollTicker.C:
+			pd.DiscoverPeers()
+		case <-saveTicker.C:
+			pd.save()
+		case <-stopCh:
+			return
+		}
 	}
 }
 
-// DiscoverPeers attempts to discover new peers in the network
+// DiscoverPeers asks every connected peer for the addresses it knows
 func (pd *PeerDiscovery) DiscoverPeers() {
-	fmt.Println("🔍 Discovering peers...")
-	
-	// In a real implementation, this would:
-	// 1. Query known peers for their peer lists
-	// 2. Use DNS-based peer discovery
-	// 3. Use hardcoded bootstrap nodes
-	// 4. Use peer exchange protocols
-	
-	// For now, we'll just print a message
-	fmt.Println("Peer discovery completed")
-}
-
-// AddDiscoveredPeer adds a discovered peer to the discovery list
-func (pd *PeerDiscovery) AddDiscoveredPeer(address string) {
-	pd.peers[address] = time.Now()
-	fmt.Printf("📝 Discovered new peer: %s\n", address)
-}
-
-// GetDiscoveredPeers returns all discovered peers
-func (pd *PeerDiscovery) GetDiscoveredPeers() []string {
-	var peers []string
-	for peer := range pd.peers {
-		peers = append(peers, peer)
-	}
-	return peers
-}
-
-// CleanupOldPeers removes peers that were discovered too long ago
-func (pd *PeerDiscovery) CleanupOldPeers(maxAge time.Duration) {
-	now := time.Now()
-	for peer, discovered := range pd.peers {
-		if now.Sub(discovered) > maxAge {
-			delete(pd.peers, peer)
-			fmt.Printf("🧹 Removed old discovered peer: %s\n", peer)
+	peers := pd.node.connectedPeers()
+	fmt.Printf("🔍 Discovering peers from %d connected peers...\n", len(peers))
+	for _, peer := range peers {
+		pd.node.sendMessage(peer, MessageTypeGetPeers, struct{}{})
+	}
+}
+
+// fillOutboundSlots connects to addresses from the address book until the
+// outbound connections, including those being made, reach the configured
+// target
+func (pd *PeerDiscovery) fillOutboundSlots() {
+	cm := pd.node.connManager
+	for cm.outboundCount() < pd.node.config.TargetOutboundPeers {
+		address := pd.book.Select(pd.skipAddress)
+		if address == "" {
+			return
+		}
+		if err := pd.node.ConnectToNode(address); err != nil {
+			return
 		}
 	}
-}
\ No newline at end of file
+}
+
+// skipAddress reports whether an address must not be dialed
+func (pd *PeerDiscovery) skipAddress(address string) bool {
+	return pd.node.connManager.connecting(address) || pd.node.HasPeer(address) ||
+		pd.node.isBanned(address) || address == pd.node.localAddress()
+}
+
+// peerConnected records the address of a peer that completed the handshake.
+// An outbound peer's address is moved to the tried table and the peer asked
+// for addresses, while an inbound peer's advertised listen address is added
+// as a new address.
+func (pd *PeerDiscovery) peerConnected(peer *Peer) {
+	if peer.Outbound {
+		pd.book.Good(peer.Address)
+		pd.node.sendMessage(peer, MessageTypeGetPeers, struct{}{})
+		return
+	}
+	if peer.ListenAddress != "" && pd.acceptAddress(peer.ListenAddress, peer.host()) {
+		pd.book.Add(peer.ListenAddress, peer.host(), time.Now())
+	}
+}
+
+// AddDiscoveredPeer adds an address advertised by a source to the address book
+func (pd *PeerDiscovery) AddDiscoveredPeer(address, source string) {
+	if address == pd.node.localAddress() || !pd.acceptAddress(address, source) {
+		return
+	}
+	if pd.book.Add(address, source, time.Now()) {
+		fmt.Printf("📝 Discovered new peer: %s\n", address)
+	}
+}
+
+// acceptAddress decides whether an address advertised by a source may be
+// learned. A non-routable address is only accepted from a source on a
+// private network itself, unless private addresses are allowed, so that
+// public peers cannot point us at hosts on our local network.
+func (pd *PeerDiscovery) acceptAddress(address, source string) bool {
+	return pd.node.config.P2PAllowPrivateAddresses || routableAddress(address) || !routableAddress(source)
+}
+
+// GetDiscoveredPeers returns all addresses in the address book
+func (pd *PeerDiscovery) GetDiscoveredPeers() []storage.PeerAddress {
+	return pd.book.Export()
+}
+
+// setStore loads the persisted address book and keeps the store updated
+func (pd *PeerDiscovery) setStore(store AddressStore) error {
+	entries, err := store.LoadPeers()
+	if err != nil {
+		return err
+	}
+	pd.book.Import(entries)
+
+	pd.mutex.Lock()
+	pd.store = store
+	pd.mutex.Unlock()
+
+	newCount, triedCount := pd.book.Size()
+	fmt.Printf("📒 Address book loaded: %d new, %d tried\n", newCount, triedCount)
+	return nil
+}
+
+// save persists the address book if a store is set
+func (pd *PeerDiscovery) save() {
+	pd.mutex.Lock()
+	store := pd.store
+	pd.mutex.Unlock()
+
+	if store == nil {
+		return
+	}
+	if err := store.SavePeers(pd.book.Export()); err != nil {
+		fmt.Printf("❌ Failed to save address book: %v\n", err)
+	}
+}
+
+// SetAddressStore loads the persisted address book and keeps the store
+// updated with newly learned addresses
+func (n *Node) SetAddressStore(store AddressStore) error {
+	if err := n.discovery.setStore(store); err != nil {
+		return fmt.Errorf("failed to load known peers: %v", err)
+	}
+	return nil
+}
+
+// GetKnownAddresses returns the addresses in the address book
+func (n *Node) GetKnownAddresses() []storage.PeerAddress {
+	return n.discovery.GetDiscoveredPeers()
+}
+
+// localAddress is the address this node accepts connections on
+func (n *Node) localAddress() string {
+	return net.JoinHostPort(n.config.Host, strconv.Itoa(n.config.Port))
+}
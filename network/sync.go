@@ -0,0 +1,468 @@
+package network
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"aetherchain/blockchain"
+)
+
+// Limits and timeouts of chain synchronization
+const (
+	MaxHeadersPerMessage = 2000 // Headers returned for one get_headers request
+	MaxBlocksPerMessage  = 500  // Blocks returned for one ranged get_blocks request
+
+	blocksPerRequest    = 16               // Block hashes requested from a peer at once
+	maxBlocksInFlight   = 64               // Outstanding block requests per peer
+	blockDownloadWindow = 1024             // How far ahead of the tip bodies are fetched
+	maxPendingHeaders   = 20000            // Headers queued ahead of their blocks
+	maxBlockRetries     = 3                // Attempts per block before the sync is abandoned
+	headersTimeout      = 30 * time.Second // Time a peer has to answer get_headers
+	blockRequestTimeout = 20 * time.Second // Time a peer has to deliver a requested block
+	syncTickInterval    = time.Second
+)
+
+// Sync states reported in SyncStatus
+const (
+	SyncStateIdle    = "idle"    // No peer known to have a better chain
+	SyncStateHeaders = "headers" // Downloading headers
+	SyncStateBlocks  = "blocks"  // Downloading block bodies for validated headers
+	SyncStateSynced  = "synced"  // At least as far as every peer we know of
+)
+
+// SyncStatus describes the progress of chain synchronization
+type SyncStatus struct {
+	State         string  `json:"state"`
+	Height        int     `json:"height"`         // Height of our best block
+	HeaderHeight  int     `json:"header_height"`  // Height of the best header received
+	PeerHeight    int     `json:"peer_height"`    // Best height announced by a peer
+	PendingBlocks int     `json:"pending_blocks"` // Headers whose block is not connected yet
+	InFlight      int     `json:"in_flight"`      // Blocks requested and not yet received
+	Progress      float64 `json:"progress"`       // Fraction of the peer height reached
+}
+
+// blockRequest is a block body requested from a peer
+type blockRequest struct {
+	peerID string
+	sent   time.Time
+}
+
+// syncMessage is a request the syncer sends once its lock is released
+type syncMessage struct {
+	peer    *Peer
+	msgType MessageType
+	data    interface{}
+}
+
+// downloadedBlock is a block waiting to be connected with the peer it came from
+type downloadedBlock struct {
+	block *blockchain.Block
+	peer  *Peer
+}
+
+// Syncer downloads the chain from peers, headers first. Headers are fetched
+// from a single peer using block locators and screened before any body is
+// requested; once they lead to more work than our chain, bodies are fetched
+// in parallel from every peer that has them and connected in header order.
+type Syncer struct {
+	node *Node
+
+	mutex       sync.Mutex
+	headerPeer  string // Peer currently serving headers, empty when none
+	headerSent  time.Time
+	headers     []*blockchain.BlockHeader // Headers of blocks still to connect, in chain order
+	headerWork  *big.Int                  // Cumulative work of the branch at the last header
+	queued      map[string]int            // Header hash to its height
+	requests    map[string]*blockRequest  // Block hash to the outstanding request
+	attempts    map[string]int            // Failed attempts per block hash
+	received    map[string]*downloadedBlock
+	peerHeights map[string]int // Best height known per peer ID
+}
+
+// NewSyncer creates a chain synchronizer for a node
+func NewSyncer(node *Node) *Syncer {
+	return &Syncer{
+		node:        node,
+		queued:      make(map[string]int),
+		requests:    make(map[string]*blockRequest),
+		attempts:    make(map[string]int),
+		received:    make(map[string]*downloadedBlock),
+		peerHeights: make(map[string]int),
+	}
+}
+
+// run drives synchronization until the node stops
+func (s *Syncer) run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(syncTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.tick()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// tick expires stalled requests and issues new ones
+func (s *Syncer) tick() {
+	peers := s.node.connectedPeers()
+
+	s.mutex.Lock()
+	now := time.Now()
+	if s.headerPeer != "" && now.Sub(s.headerSent) > headersTimeout {
+		fmt.Printf("⏱️ Peer %s did not answer get_headers in time\n", s.headerPeer)
+		delete(s.peerHeights, s.headerPeer)
+		s.headerPeer = ""
+	}
+	for hash, request := range s.requests {
+		if now.Sub(request.sent) > blockRequestTimeout && !s.failRequest(hash) {
+			break
+		}
+	}
+
+	var messages []syncMessage
+	if s.headerPeer == "" && len(s.headers) < maxPendingHeaders {
+		messages = append(messages, s.requestHeaders(peers)...)
+	}
+	messages = append(messages, s.requestBlocks(peers)...)
+	s.mutex.Unlock()
+
+	s.send(messages)
+}
+
+// send sends requests collected under the lock
+func (s *Syncer) send(messages []syncMessage) {
+	for _, message := range messages {
+		s.node.sendMessage(message.peer, message.msgType, message.data)
+	}
+}
+
+// requestHeaders asks the best peer for headers following our chain. Peers
+// whose height is unknown are asked too, the answer tells us their height.
+func (s *Syncer) requestHeaders(peers []*Peer) []syncMessage {
+	height := s.headerHeight()
+	var best *Peer
+	for _, peer := range peers {
+		peerHeight, known := s.peerHeights[peer.ID]
+		if !peer.HasService(ServiceHeaders) || (known && peerHeight <= height) {
+			continue
+		}
+		if best == nil || peerHeight > s.peerHeights[best.ID] {
+			best = peer
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return []syncMessage{s.getHeaders(best)}
+}
+
+// getHeaders returns the request for the headers following our best known
+// header, and marks the peer as serving headers
+func (s *Syncer) getHeaders(peer *Peer) syncMessage {
+	locator := s.node.blockchain.BlockLocator()
+	if len(s.headers) > 0 {
+		locator = append([]string{s.headers[len(s.headers)-1].CalculateHash()}, locator...)
+	}
+
+	s.headerPeer = peer.ID
+	s.headerSent = time.Now()
+	return syncMessage{peer: peer, msgType: MessageTypeGetHeaders, data: GetHeadersMessage{Locator: locator}}
+}
+
+// requestBlocks spreads requests for the next missing bodies across peers.
+// Nothing is requested until the queued headers lead to more work than our
+// chain, so a peer cannot make us download a branch we would not switch to.
+func (s *Syncer) requestBlocks(peers []*Peer) []syncMessage {
+	if len(s.headers) == 0 || len(peers) == 0 {
+		return nil
+	}
+	if s.headerWork == nil || s.headerWork.Cmp(s.node.blockchain.TipWork()) <= 0 {
+		return nil
+	}
+
+	inFlight := make(map[string]int)
+	for _, request := range s.requests {
+		inFlight[request.peerID]++
+	}
+	batches := make(map[*Peer][]string)
+
+	next := 0
+	for _, header := range s.headers[:min(len(s.headers), blockDownloadWindow)] {
+		hash := header.CalculateHash()
+		if _, done := s.received[hash]; done {
+			continue
+		}
+		if _, requested := s.requests[hash]; requested {
+			continue
+		}
+
+		// Pick the next peer in turn that has the block and spare capacity
+		var peer *Peer
+		for tried := 0; tried < len(peers) && peer == nil; tried++ {
+			candidate := peers[next%len(peers)]
+			next++
+			if candidate.HasService(ServiceBlocks) && s.peerHeights[candidate.ID] >= header.Index &&
+				inFlight[candidate.ID] < maxBlocksInFlight {
+				peer = candidate
+			}
+		}
+		if peer == nil {
+			break
+		}
+
+		inFlight[peer.ID]++
+		s.requests[hash] = &blockRequest{peerID: peer.ID, sent: time.Now()}
+		batches[peer] = append(batches[peer], hash)
+	}
+
+	var messages []syncMessage
+	for peer, hashes := range batches {
+		for start := 0; start < len(hashes); start += blocksPerRequest {
+			end := min(start+blocksPerRequest, len(hashes))
+			messages = append(messages, syncMessage{
+				peer:    peer,
+				msgType: MessageTypeGetBlocks,
+				data:    GetBlocksMessage{Hashes: hashes[start:end]},
+			})
+		}
+	}
+	return messages
+}
+
+// failRequest gives up on an outstanding block request so that it is retried,
+// possibly from another peer. After too many attempts the sync is abandoned
+// and false is returned.
+func (s *Syncer) failRequest(hash string) bool {
+	delete(s.requests, hash)
+
+	s.attempts[hash]++
+	if s.attempts[hash] >= maxBlockRetries {
+		fmt.Printf("❌ Block %s could not be downloaded after %d attempts, restarting sync\n",
+			hash[:16], maxBlockRetries)
+		s.reset()
+		return false
+	}
+	return true
+}
+
+// reset drops every downloaded header and body
+func (s *Syncer) reset() {
+	s.headers = nil
+	s.headerWork = nil
+	s.queued = make(map[string]int)
+	s.requests = make(map[string]*blockRequest)
+	s.attempts = make(map[string]int)
+	s.received = make(map[string]*downloadedBlock)
+}
+
+// handleHeaders screens headers received from a peer and queues their bodies
+// for download, asking the same peer for more if the message was full
+func (s *Syncer) handleHeaders(peer *Peer, headers []*blockchain.BlockHeader) error {
+	s.mutex.Lock()
+	messages, err := s.queueHeaders(peer, headers)
+	s.mutex.Unlock()
+
+	s.send(messages)
+	return err
+}
+
+// queueHeaders does the work of handleHeaders under the lock and returns the
+// follow-up request, if any
+func (s *Syncer) queueHeaders(peer *Peer, headers []*blockchain.BlockHeader) ([]syncMessage, error) {
+	if peer.ID != s.headerPeer {
+		return nil, fmt.Errorf("unsolicited headers")
+	}
+	s.headerPeer = ""
+	full := len(headers) == MaxHeadersPerMessage
+
+	// Skip headers we already have, they precede the fork point
+	bc := s.node.blockchain
+	for len(headers) > 0 {
+		hash := headers[0].CalculateHash()
+		if _, queued := s.queued[hash]; !queued && !bc.HaveBlock(hash) {
+			break
+		}
+		headers = headers[1:]
+	}
+	if len(headers) == 0 {
+		s.peerHeights[peer.ID] = s.headerHeight()
+		return nil, nil
+	}
+
+	// Headers branching off earlier than the queued ones replace them
+	var base []*blockchain.BlockHeader
+	if height, queued := s.queued[headers[0].PrevHash]; queued {
+		base = s.headers[:height-s.headers[0].Index+1]
+	}
+	if room := maxPendingHeaders - len(base); len(headers) > room {
+		headers = headers[:room]
+	}
+	if len(headers) == 0 {
+		return nil, nil
+	}
+
+	// The headers must form a chain from a block or header we know, each with
+	// the target of its branch
+	work, err := bc.CheckHeaderChain(base, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	if base != nil {
+		s.truncateHeaders(len(base))
+	} else {
+		s.reset()
+	}
+	for _, header := range headers {
+		s.queued[header.CalculateHash()] = header.Index
+		s.headers = append(s.headers, header)
+	}
+	s.headerWork = work
+
+	last := headers[len(headers)-1].Index
+	s.peerHeights[peer.ID] = max(s.peerHeights[peer.ID], last)
+	fmt.Printf("📑 Received %d headers from %s, best header %d\n", len(headers), peer.Address, last)
+
+	if full && len(s.headers) < maxPendingHeaders {
+		return []syncMessage{s.getHeaders(peer)}, nil
+	}
+
+	// A finished branch without more work than our chain is not worth its bodies
+	if work.Cmp(bc.TipWork()) <= 0 {
+		fmt.Printf("📑 Headers from %s do not lead to more work than our chain, dropping them\n", peer.Address)
+		s.reset()
+		s.peerHeights[peer.ID] = s.headerHeight()
+	}
+	return nil, nil
+}
+
+// truncateHeaders drops queued headers from position on
+func (s *Syncer) truncateHeaders(position int) {
+	for _, header := range s.headers[position:] {
+		hash := header.CalculateHash()
+		delete(s.queued, hash)
+		delete(s.requests, hash)
+		delete(s.attempts, hash)
+		delete(s.received, hash)
+	}
+	s.headers = s.headers[:position]
+}
+
+// deliverBlock takes a block requested by the syncer and connects every
+// downloaded block that is next in header order. It returns false for
+// blocks the syncer is not waiting for.
+func (s *Syncer) deliverBlock(peer *Peer, block *blockchain.Block) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, queued := s.queued[block.Hash]; !queued {
+		return false
+	}
+	delete(s.requests, block.Hash)
+	s.received[block.Hash] = &downloadedBlock{block: block, peer: peer}
+
+	bc := s.node.blockchain
+	for len(s.headers) > 0 {
+		hash := s.headers[0].CalculateHash()
+		next, downloaded := s.received[hash]
+		if !downloaded {
+			break
+		}
+
+		if !bc.HaveBlock(hash) {
+			if err := bc.AddBlock(next.block); err != nil {
+				fmt.Printf("❌ Synced block %d rejected: %v\n", next.block.Index, err)
+				s.node.misbehaving(next.peer, scoreInvalidBlock, fmt.Sprintf("invalid block %d: %v", next.block.Index, err))
+				s.reset()
+				return true
+			}
+		}
+		s.truncateFront()
+	}
+
+	if len(s.headers) == 0 {
+		fmt.Printf("✅ Synchronized to height %d\n", bc.GetLastBlock().Index)
+	}
+	return true
+}
+
+// truncateFront drops the first queued header after its block was connected
+func (s *Syncer) truncateFront() {
+	hash := s.headers[0].CalculateHash()
+	delete(s.queued, hash)
+	delete(s.received, hash)
+	delete(s.attempts, hash)
+	s.headers = s.headers[1:]
+}
+
+// updatePeerHeight records the best height a peer has announced
+func (s *Syncer) updatePeerHeight(peer *Peer, height int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.peerHeights[peer.ID] = max(s.peerHeights[peer.ID], height)
+}
+
+// removePeer forgets a disconnected peer and retries its requests elsewhere
+func (s *Syncer) removePeer(peerID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.peerHeights, peerID)
+	if s.headerPeer == peerID {
+		s.headerPeer = ""
+	}
+	for hash, request := range s.requests {
+		if request.peerID == peerID {
+			delete(s.requests, hash)
+		}
+	}
+}
+
+// headerHeight returns the height of the best header, downloaded or connected
+func (s *Syncer) headerHeight() int {
+	if len(s.headers) > 0 {
+		return s.headers[len(s.headers)-1].Index
+	}
+	return s.node.blockchain.GetLastBlock().Index
+}
+
+// Status reports synchronization progress
+func (s *Syncer) Status() SyncStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	status := SyncStatus{
+		Height:        s.node.blockchain.GetLastBlock().Index,
+		HeaderHeight:  s.headerHeight(),
+		PendingBlocks: len(s.headers),
+		InFlight:      len(s.requests),
+	}
+	for _, height := range s.peerHeights {
+		status.PeerHeight = max(status.PeerHeight, height)
+	}
+	status.PeerHeight = max(status.PeerHeight, status.HeaderHeight)
+
+	switch {
+	case len(s.headers) > 0:
+		status.State = SyncStateBlocks
+	case s.headerPeer != "":
+		status.State = SyncStateHeaders
+	case len(s.peerHeights) == 0:
+		status.State = SyncStateIdle
+	default:
+		status.State = SyncStateSynced
+	}
+
+	status.Progress = 1
+	if status.PeerHeight > 0 {
+		status.Progress = min(float64(status.Height)/float64(status.PeerHeight), 1)
+	}
+	return status
+}
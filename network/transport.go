@@ -0,0 +1,343 @@
+package network
+
+import (
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"aetherchain/config"
+	"aetherchain/crypto"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Transport negotiation. Before any message is exchanged both sides send a
+// hello of network magic, transport version and flags. If both offer
+// encryption the connection is upgraded with a key exchange:
+//
+//  1. each side sends an ephemeral X25519 public key
+//  2. both derive one ChaCha20-Poly1305 key per direction from the shared
+//     secret, salted with a hash of the two ephemeral keys
+//  3. each side sends, encrypted, its identity public key and a signature
+//     of that hash made with its identity key, which proves possession of
+//     the identity key and binds it to this session
+//
+// Afterwards every write is sent as encrypted records of a 4-byte length
+// followed by the sealed data, with a counter nonce per direction.
+const (
+	transportVersion      = 1
+	transportHelloSize    = 6
+	transportProtocolName = "aetherchain-p2p-v1"
+
+	transportFlagEncrypt = 1 << 0 // Offers an encrypted transport
+	transportFlagRequire = 1 << 1 // Refuses a plaintext transport
+
+	maxRecordSize = 64 << 10 // Plaintext bytes sealed in one record
+)
+
+// nodeIdentityKey is the key pair name of the node's transport identity
+const nodeIdentityKey = "node_identity"
+
+// loadNodeIdentity loads the node's identity key pair and reports whether it
+// outlives this run. With an identity passphrase the key is kept in an
+// encrypted keystore, created on first use. Without one no key is written: a
+// plaintext key left by older versions is still used, and otherwise the node
+// gets a new identity for this run only.
+func loadNodeIdentity(cfg *config.Config) (*crypto.KeyPair, bool, error) {
+	keyManager := crypto.NewKeyManager(filepath.Join(cfg.DataDirectory, "keys"))
+	passphrase := cfg.P2PIdentityPassphrase
+
+	if !keyManager.KeyExists(nodeIdentityKey) {
+		keyPair, err := keyManager.GenerateKeyPair()
+		if err != nil {
+			return nil, false, err
+		}
+		if passphrase == "" {
+			fmt.Println("⚠️ No identity passphrase configured, the node identity lasts for this run only")
+			return keyPair, false, nil
+		}
+		if err := keyManager.SaveEncryptedKeyPair(keyPair, nodeIdentityKey, passphrase); err != nil {
+			return nil, false, err
+		}
+		return keyPair, true, nil
+	}
+
+	encrypted, err := keyManager.IsEncrypted(nodeIdentityKey)
+	if err != nil {
+		return nil, false, err
+	}
+	switch {
+	case !encrypted && passphrase == "":
+		keyPair, err := keyManager.LoadKeyPair(nodeIdentityKey)
+		return keyPair, err == nil, err
+	case !encrypted:
+		if err := keyManager.MigrateKeyPair(nodeIdentityKey, passphrase); err != nil {
+			return nil, false, err
+		}
+	case passphrase == "":
+		return nil, false, fmt.Errorf("the node identity is encrypted but no identity passphrase is configured")
+	}
+	keyPair, err := keyManager.Unlock(nodeIdentityKey, passphrase)
+	return keyPair, err == nil, err
+}
+
+// peerIdentity is a peer's verified transport identity
+type peerIdentity struct {
+	publicKey string // Hex-encoded PKIX identity public key
+	address   string // Address derived from the identity public key
+}
+
+// secureTransport negotiates the transport of a new connection and returns
+// the connection to use for messages, which is conn itself when the peers
+// agreed on plaintext. The identity is nil for plaintext connections.
+func (n *Node) secureTransport(conn net.Conn, outbound bool) (net.Conn, *peerIdentity, error) {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	var flags byte
+	if n.identity != nil {
+		flags |= transportFlagEncrypt
+	}
+	if n.config.P2PRequireEncryption {
+		flags |= transportFlagRequire
+	}
+
+	hello := make([]byte, transportHelloSize)
+	binary.BigEndian.PutUint32(hello[0:4], n.magic)
+	hello[4] = transportVersion
+	hello[5] = flags
+	if _, err := conn.Write(hello); err != nil {
+		return nil, nil, err
+	}
+	remoteHello := make([]byte, transportHelloSize)
+	if _, err := io.ReadFull(conn, remoteHello); err != nil {
+		return nil, nil, err
+	}
+	if magic := binary.BigEndian.Uint32(remoteHello[0:4]); magic != n.magic {
+		return nil, nil, fmt.Errorf("unexpected network magic %#08x", magic)
+	}
+	if remoteHello[4] != transportVersion {
+		return nil, nil, fmt.Errorf("unsupported transport version %d", remoteHello[4])
+	}
+
+	remoteFlags := remoteHello[5]
+	if flags&remoteFlags&transportFlagEncrypt == 0 {
+		if flags&transportFlagRequire != 0 {
+			return nil, nil, fmt.Errorf("peer does not support encrypted transport")
+		}
+		if remoteFlags&transportFlagRequire != 0 {
+			return nil, nil, fmt.Errorf("peer requires encrypted transport")
+		}
+		return conn, nil, nil
+	}
+
+	return n.encryptTransport(conn, outbound, hello, remoteHello)
+}
+
+// encryptTransport runs the key exchange and identity proof. Both hellos are
+// part of the signed transcript, so a peer notices if its hello was altered.
+func (n *Node) encryptTransport(conn net.Conn, outbound bool, hello, remoteHello []byte) (net.Conn, *peerIdentity, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := conn.Write(ephemeral.PublicKey().Bytes()); err != nil {
+		return nil, nil, err
+	}
+	remoteEphemeralBytes := make([]byte, len(ephemeral.PublicKey().Bytes()))
+	if _, err := io.ReadFull(conn, remoteEphemeralBytes); err != nil {
+		return nil, nil, err
+	}
+	remoteEphemeral, err := ecdh.X25519().NewPublicKey(remoteEphemeralBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid ephemeral key: %v", err)
+	}
+	secret, err := ephemeral.ECDH(remoteEphemeral)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The dialer is the initiator, which fixes the order of hellos, keys and
+	// roles
+	initiatorHello, responderHello := hello, remoteHello
+	initiatorKey, responderKey := ephemeral.PublicKey().Bytes(), remoteEphemeralBytes
+	localRole, remoteRole := byte('I'), byte('R')
+	if !outbound {
+		initiatorHello, responderHello = responderHello, initiatorHello
+		initiatorKey, responderKey = responderKey, initiatorKey
+		localRole, remoteRole = remoteRole, localRole
+	}
+	transcript := sha256.New()
+	transcript.Write([]byte(transportProtocolName))
+	transcript.Write(initiatorHello)
+	transcript.Write(responderHello)
+	transcript.Write(initiatorKey)
+	transcript.Write(responderKey)
+	sessionHash := transcript.Sum(nil)
+
+	keys := make([]byte, 2*chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, sessionHash, []byte("transport keys")), keys); err != nil {
+		return nil, nil, err
+	}
+	sendKey, recvKey := keys[:chacha20poly1305.KeySize], keys[chacha20poly1305.KeySize:]
+	if !outbound {
+		sendKey, recvKey = recvKey, sendKey
+	}
+	secure, err := newSecureConn(conn, sendKey, recvKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Prove our identity and verify the peer's
+	publicKey, err := crypto.MarshalPublicKey(n.identity.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	signature, err := crypto.Sign(identityChallenge(sessionHash, localRole), n.identity.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeIdentityProof(secure, publicKey, signature); err != nil {
+		return nil, nil, err
+	}
+
+	remotePublicKey, remoteSignature, err := readIdentityProof(secure)
+	if err != nil {
+		return nil, nil, err
+	}
+	remoteKey, err := crypto.ParsePublicKey(remotePublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid identity key: %v", err)
+	}
+	if !crypto.Verify(identityChallenge(sessionHash, remoteRole), remoteSignature, remoteKey) {
+		return nil, nil, fmt.Errorf("invalid identity signature")
+	}
+	address, err := crypto.AddressFromPublicKey(remoteKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return secure, &peerIdentity{publicKey: hex.EncodeToString(remotePublicKey), address: address}, nil
+}
+
+// identityChallenge is the data a side signs to prove its identity
+func identityChallenge(sessionHash []byte, role byte) []byte {
+	return append(append([]byte(nil), sessionHash...), role)
+}
+
+// writeIdentityProof sends a public key and a hex signature, each prefixed
+// with its 2-byte length
+func writeIdentityProof(w io.Writer, publicKey []byte, signature string) error {
+	proof := make([]byte, 0, 4+len(publicKey)+len(signature))
+	proof = binary.BigEndian.AppendUint16(proof, uint16(len(publicKey)))
+	proof = append(proof, publicKey...)
+	proof = binary.BigEndian.AppendUint16(proof, uint16(len(signature)))
+	proof = append(proof, signature...)
+	_, err := w.Write(proof)
+	return err
+}
+
+// readIdentityProof reads what writeIdentityProof sent
+func readIdentityProof(r io.Reader) ([]byte, string, error) {
+	var fields [2][]byte
+	for i := range fields {
+		var length [2]byte
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			return nil, "", err
+		}
+		fields[i] = make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(r, fields[i]); err != nil {
+			return nil, "", err
+		}
+	}
+	return fields[0], string(fields[1]), nil
+}
+
+// secureConn encrypts and authenticates everything written to a connection
+type secureConn struct {
+	net.Conn
+
+	send, recv           cipher.AEAD
+	sendNonce, recvNonce uint64
+	readBuffer           []byte // Decrypted data not yet returned by Read
+	writeMutex           sync.Mutex
+}
+
+func newSecureConn(conn net.Conn, sendKey, recvKey []byte) (*secureConn, error) {
+	send, err := chacha20poly1305.New(sendKey)
+	if err != nil {
+		return nil, err
+	}
+	recv, err := chacha20poly1305.New(recvKey)
+	if err != nil {
+		return nil, err
+	}
+	return &secureConn{Conn: conn, send: send, recv: recv}, nil
+}
+
+// Read returns decrypted data, reading the next record when none is buffered
+func (c *secureConn) Read(p []byte) (int, error) {
+	if len(c.readBuffer) == 0 {
+		var length [4]byte
+		if _, err := io.ReadFull(c.Conn, length[:]); err != nil {
+			return 0, err
+		}
+		size := binary.BigEndian.Uint32(length[:])
+		if size > maxRecordSize+uint32(c.recv.Overhead()) {
+			return 0, fmt.Errorf("encrypted record of %d bytes is too large", size)
+		}
+
+		record := make([]byte, size)
+		if _, err := io.ReadFull(c.Conn, record); err != nil {
+			return 0, err
+		}
+		plaintext, err := c.recv.Open(record[:0], recordNonce(c.recvNonce), record, nil)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt record: %v", err)
+		}
+		c.recvNonce++
+		c.readBuffer = plaintext
+	}
+
+	n := copy(p, c.readBuffer)
+	c.readBuffer = c.readBuffer[n:]
+	return n, nil
+}
+
+// Write seals data into one or more records
+func (c *secureConn) Write(p []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	written := 0
+	for written < len(p) {
+		chunk := p[written:min(len(p), written+maxRecordSize)]
+
+		record := make([]byte, 4, 4+len(chunk)+c.send.Overhead())
+		record = c.send.Seal(record, recordNonce(c.sendNonce), chunk, nil)
+		binary.BigEndian.PutUint32(record[0:4], uint32(len(record)-4))
+		if _, err := c.Conn.Write(record); err != nil {
+			return written, err
+		}
+		c.sendNonce++
+		written += len(chunk)
+	}
+	return written, nil
+}
+
+// recordNonce encodes a record counter as a ChaCha20-Poly1305 nonce
+func recordNonce(counter uint64) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
@@ -0,0 +1,370 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"aetherchain/blockchain"
+	"aetherchain/config"
+	"aetherchain/crypto"
+)
+
+// startTestNode starts an encrypting node listening on a loopback port
+func startTestNode(t *testing.T) *Node {
+	t.Helper()
+
+	cfg := config.DefaultConfig()
+	cfg.Host = "127.0.0.1"
+	cfg.Port = 0
+	cfg.DataDirectory = t.TempDir()
+	cfg.BootstrapNodes = nil
+
+	bc := blockchain.NewBlockchain(cfg.GenesisBits, blockchain.EmissionSchedule{}, blockchain.RetargetPolicy{})
+	node := NewNode(cfg, bc)
+	if err := node.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(node.Stop)
+	return node
+}
+
+// connectPeers connects two nodes over loopback TCP and sets up the peer on
+// both ends. wrap, if not nil, wraps the dialer's end of the connection.
+func connectPeers(t *testing.T, dialer, listener *Node, wrap func(net.Conn) net.Conn) (outbound, inbound *Peer, outErr, inErr error) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := ln.Accept()
+		if err != nil {
+			inErr = err
+			return
+		}
+		t.Cleanup(func() { conn.Close() })
+		inbound, inErr = listener.setupPeer(conn, conn.RemoteAddr().String(), false)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if wrap != nil {
+		conn = wrap(conn)
+	}
+	outbound, outErr = dialer.setupPeer(conn, ln.Addr().String(), true)
+	<-done
+	return outbound, inbound, outErr, inErr
+}
+
+// readPing reads messages from a peer until a ping carrying hash arrives
+func readPing(peer *Peer, hash string) (*PingMessage, error) {
+	for {
+		message, err := peer.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		var ping PingMessage
+		if message.Type == MessageTypePing && json.Unmarshal(message.Data, &ping) == nil && ping.BestHash == hash {
+			return &ping, nil
+		}
+	}
+}
+
+// waitFor polls condition until it holds or a deadline passes
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// recordingConn keeps a copy of everything written to a connection
+type recordingConn struct {
+	net.Conn
+	mutex   sync.Mutex
+	written bytes.Buffer
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	c.mutex.Lock()
+	c.written.Write(p)
+	c.mutex.Unlock()
+	return c.Conn.Write(p)
+}
+
+// tamperConn flips the last bit of every write once armed
+type tamperConn struct {
+	net.Conn
+	armed atomic.Bool
+}
+
+func (c *tamperConn) Write(p []byte) (int, error) {
+	if c.armed.Load() {
+		p = append([]byte(nil), p...)
+		p[len(p)-1] ^= 1
+	}
+	return c.Conn.Write(p)
+}
+
+// helloConn clears flag bits in the transport hellos it sends and, if
+// inbound is set, in the hello it receives
+type helloConn struct {
+	net.Conn
+	clear         byte
+	inbound       bool
+	read, written int
+}
+
+func (c *helloConn) Write(p []byte) (int, error) {
+	if c.written == 0 && len(p) >= transportHelloSize {
+		p = append([]byte(nil), p...)
+		p[5] &^= c.clear
+	}
+	c.written += len(p)
+	return c.Conn.Write(p)
+}
+
+func (c *helloConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if c.inbound && c.read <= 5 && c.read+n > 5 {
+		p[5-c.read] &^= c.clear
+	}
+	c.read += n
+	return n, err
+}
+
+func TestEncryptedHandshake(t *testing.T) {
+	a, b := startTestNode(t), startTestNode(t)
+
+	if err := b.ConnectToNode(a.listener.Addr().String()); err != nil {
+		t.Fatalf("ConnectToNode: %v", err)
+	}
+	waitFor(t, "both nodes to add the peer", func() bool {
+		return a.GetPeerCount() == 1 && b.GetPeerCount() == 1
+	})
+
+	inbound, outbound := a.connectedPeers()[0], b.connectedPeers()[0]
+	for _, check := range []struct {
+		peer   *Peer
+		remote *Node
+	}{{inbound, b}, {outbound, a}} {
+		if !check.peer.Encrypted {
+			t.Errorf("peer %s is not encrypted", check.peer.Address)
+		}
+		if check.peer.Identity != check.remote.identity.Address || check.peer.ID != check.remote.identity.Address {
+			t.Errorf("peer identity %s with ID %s, want %s", check.peer.Identity, check.peer.ID, check.remote.identity.Address)
+		}
+	}
+
+	// A pong only arrives if the ping and the pong both crossed the
+	// encrypted connection
+	b.pingPeers()
+	waitFor(t, "the pong", func() bool {
+		rtt, _, _ := outbound.keepalive.status()
+		return rtt > 0
+	})
+}
+
+func TestEncryptedMessageRoundTrip(t *testing.T) {
+	a, b := startTestNode(t), startTestNode(t)
+
+	var recorder *recordingConn
+	outbound, inbound, outErr, inErr := connectPeers(t, b, a, func(conn net.Conn) net.Conn {
+		recorder = &recordingConn{Conn: conn}
+		return recorder
+	})
+	if outErr != nil || inErr != nil {
+		t.Fatalf("setup failed: outbound %v, inbound %v", outErr, inErr)
+	}
+
+	const marker = "round-trip-marker"
+	b.sendMessage(outbound, MessageTypePing, PingMessage{Nonce: 7, Height: 3, BestHash: marker})
+	ping, err := readPing(inbound, marker)
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if ping.Nonce != 7 || ping.Height != 3 {
+		t.Errorf("received %+v", ping)
+	}
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	if bytes.Contains(recorder.written.Bytes(), []byte(marker)) {
+		t.Error("message was sent in plaintext")
+	}
+}
+
+func TestTamperedFrameRejected(t *testing.T) {
+	a, b := startTestNode(t), startTestNode(t)
+
+	var tamper *tamperConn
+	outbound, inbound, outErr, inErr := connectPeers(t, b, a, func(conn net.Conn) net.Conn {
+		tamper = &tamperConn{Conn: conn}
+		return tamper
+	})
+	if outErr != nil || inErr != nil {
+		t.Fatalf("setup failed: outbound %v, inbound %v", outErr, inErr)
+	}
+
+	tamper.armed.Store(true)
+	b.sendMessage(outbound, MessageTypePing, PingMessage{Nonce: 7, BestHash: "tampered"})
+	_, err := readPing(inbound, "tampered")
+	if err == nil || !strings.Contains(err.Error(), "failed to decrypt record") {
+		t.Fatalf("tampered frame read with error %v", err)
+	}
+}
+
+func TestInvalidIdentitySignatureDropped(t *testing.T) {
+	a, b := startTestNode(t), startTestNode(t)
+
+	// Claim an identity without its private key, so that the signature
+	// does not verify against the claimed public key
+	other, err := crypto.NewKeyManager(t.TempDir()).GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair: %v", err)
+	}
+	b.identity = &crypto.KeyPair{
+		PublicKey:  other.PublicKey,
+		PrivateKey: b.identity.PrivateKey,
+		Address:    other.Address,
+	}
+
+	_, _, outErr, inErr := connectPeers(t, b, a, nil)
+	if inErr == nil || !strings.Contains(inErr.Error(), "invalid identity signature") {
+		t.Errorf("inbound setup error %v, want an invalid identity signature", inErr)
+	}
+	if outErr == nil {
+		t.Error("outbound setup succeeded")
+	}
+	if a.GetPeerCount() != 0 {
+		t.Errorf("node kept %d peers", a.GetPeerCount())
+	}
+}
+
+func TestNodeIDMustMatchIdentity(t *testing.T) {
+	a, b := startTestNode(t), startTestNode(t)
+	b.config.NodeID = a.identity.Address
+
+	_, _, _, inErr := connectPeers(t, b, a, nil)
+	if inErr == nil || !strings.Contains(inErr.Error(), "does not match identity") {
+		t.Errorf("inbound setup error %v, want a node ID mismatch", inErr)
+	}
+	if a.GetPeerCount() != 0 {
+		t.Errorf("node kept %d peers", a.GetPeerCount())
+	}
+}
+
+func TestPinnedIdentity(t *testing.T) {
+	tests := []struct {
+		name    string
+		pin     func(a *Node) string
+		wantErr string
+	}{
+		{"matching", func(a *Node) string { return a.identity.Address }, ""},
+		{"mismatching", func(*Node) string { return "0x0000000000000000000000000000000000000000" }, "does not match the pinned identity"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := startTestNode(t), startTestNode(t)
+
+			// Pin the listener's address directly, so that the connection
+			// manager does not dial it on its own
+			_, _, outErr, _ := connectPeers(t, b, a, func(conn net.Conn) net.Conn {
+				address := conn.RemoteAddr().String()
+				b.connManager.mutex.Lock()
+				b.connManager.persistent[address] = &persistentPeer{
+					address:     address,
+					identity:    test.pin(a),
+					nextAttempt: time.Now().Add(time.Hour),
+				}
+				b.connManager.mutex.Unlock()
+				return conn
+			})
+			if test.wantErr == "" && outErr != nil {
+				t.Errorf("setup failed: %v", outErr)
+			}
+			if test.wantErr != "" && (outErr == nil || !strings.Contains(outErr.Error(), test.wantErr)) {
+				t.Errorf("setup error %v, want %q", outErr, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestAddPersistentPeerPinsIdentity(t *testing.T) {
+	node := startTestNode(t)
+
+	if err := node.AddPersistentPeer("0x1234@127.0.0.1:1"); err != nil {
+		t.Fatalf("AddPersistentPeer: %v", err)
+	}
+	node.connManager.mutex.Lock()
+	defer node.connManager.mutex.Unlock()
+	peer, exists := node.connManager.persistent["127.0.0.1:1"]
+	if !exists || peer.identity != "0x1234" {
+		t.Errorf("persistent peer %+v, want identity 0x1234", peer)
+	}
+}
+
+func TestAlteredHelloRejected(t *testing.T) {
+	a, b := startTestNode(t), startTestNode(t)
+	a.config.P2PRequireEncryption = true
+
+	// Clearing the require flag leaves both sides encrypting, but with
+	// different transcripts and so different keys
+	_, _, outErr, inErr := connectPeers(t, b, a, func(conn net.Conn) net.Conn {
+		return &helloConn{Conn: conn, clear: transportFlagRequire, inbound: true}
+	})
+	if inErr == nil || !strings.Contains(inErr.Error(), "failed to decrypt record") {
+		t.Errorf("inbound setup error %v, want a failed decryption", inErr)
+	}
+	if outErr == nil {
+		t.Error("outbound setup succeeded")
+	}
+}
+
+func TestPlaintextDowngradeRejected(t *testing.T) {
+	a, b := startTestNode(t), startTestNode(t)
+
+	_, _, outErr, inErr := connectPeers(t, b, a, func(conn net.Conn) net.Conn {
+		return &helloConn{Conn: conn, clear: transportFlagEncrypt, inbound: true}
+	})
+	for _, err := range []error{outErr, inErr} {
+		if err == nil || !strings.Contains(err.Error(), "not encrypted") {
+			t.Errorf("setup error %v, want a refused plaintext connection", err)
+		}
+	}
+}
+
+func TestPinnedBootstrapRequiresPersistentIdentity(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Host = "127.0.0.1"
+	cfg.Port = 0
+	cfg.DataDirectory = t.TempDir()
+	cfg.BootstrapNodes = []string{"0x1234@127.0.0.1:1"}
+
+	bc := blockchain.NewBlockchain(cfg.GenesisBits, blockchain.EmissionSchedule{}, blockchain.RetargetPolicy{})
+	node := NewNode(cfg, bc)
+	if err := node.Start(); err == nil || !strings.Contains(err.Error(), "not persistent") {
+		node.Stop()
+		t.Fatalf("Start error %v, want a non-persistent identity", err)
+	}
+}
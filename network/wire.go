@@ -0,0 +1,149 @@
+package network
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// Wire framing. Every message is sent as a fixed 24-byte header followed by
+// the payload, which is the JSON-encoded NetworkMessage:
+//
+//	magic    4 bytes  network identifier, big-endian
+//	command 12 bytes  message type, ASCII padded with zero bytes
+//	length   4 bytes  payload length, big-endian
+//	checksum 4 bytes  first four bytes of SHA-256 of the payload
+const (
+	frameHeaderSize = 24
+	commandSize     = 12
+
+	// MaxMessageSize bounds the payload of a single message
+	MaxMessageSize = 32 << 20
+
+	// maxHandshakeMessageSize bounds the payload of a message read before
+	// the handshake completes. Only version and verack messages may arrive
+	// then, which take a few hundred bytes.
+	maxHandshakeMessageSize = 4 << 10
+
+	// payloadChunkSize is how much of a payload is read at a time, so that
+	// memory grows with the data received rather than the declared length
+	payloadChunkSize = 64 << 10
+
+	// writeTimeout bounds how long a write to a slow peer may block
+	writeTimeout = 30 * time.Second
+)
+
+// networkMagic identifies each network so that nodes of different networks
+// cannot talk to each other by accident
+var networkMagic = map[string]uint32{
+	"mainnet": 0xae7e4c01,
+	"testnet": 0xae7e4c02,
+	"dev":     0xae7e4c03,
+}
+
+// ErrProtocolViolation is returned when a peer sends data that does not
+// follow the wire protocol, as opposed to a failing connection
+var ErrProtocolViolation = errors.New("protocol violation")
+
+// magicForEnvironment returns the magic of a network, defaulting to dev
+func magicForEnvironment(environment string) uint32 {
+	if magic, known := networkMagic[environment]; known {
+		return magic
+	}
+	return networkMagic["dev"]
+}
+
+// ReadMessage reads the next framed message from the peer. Any error leaves
+// the stream in an unknown state, so the connection should be closed.
+func (p *Peer) ReadMessage() (*NetworkMessage, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(p.reader, header[:]); err != nil {
+		return nil, err
+	}
+
+	if magic := binary.BigEndian.Uint32(header[0:4]); magic != p.magic {
+		return nil, fmt.Errorf("%w: unexpected network magic %#08x", ErrProtocolViolation, magic)
+	}
+	command := MessageType(bytes.TrimRight(header[4:4+commandSize], "\x00"))
+	length := binary.BigEndian.Uint32(header[16:20])
+	if length > p.maxPayload {
+		return nil, fmt.Errorf("%w: %s message of %d bytes exceeds the %d byte limit",
+			ErrProtocolViolation, command, length, p.maxPayload)
+	}
+
+	payload, err := readPayload(p.reader, int(length))
+	if err != nil {
+		return nil, err
+	}
+	if checksum := payloadChecksum(payload); !bytes.Equal(checksum[:], header[20:24]) {
+		return nil, fmt.Errorf("%w: %s message checksum mismatch", ErrProtocolViolation, command)
+	}
+
+	var message NetworkMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		return nil, fmt.Errorf("%w: invalid %s message: %v", ErrProtocolViolation, command, err)
+	}
+	if message.Type != command {
+		return nil, fmt.Errorf("%w: %s message framed as %s", ErrProtocolViolation, message.Type, command)
+	}
+	return &message, nil
+}
+
+// readPayload reads a payload of the given length in chunks of at most
+// payloadChunkSize bytes
+func readPayload(r io.Reader, length int) ([]byte, error) {
+	payload := make([]byte, 0, min(length, payloadChunkSize))
+	for len(payload) < length {
+		chunk := min(length-len(payload), payloadChunkSize)
+		payload = slices.Grow(payload, chunk)[:len(payload)+chunk]
+		if _, err := io.ReadFull(r, payload[len(payload)-chunk:]); err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// WriteMessage frames and sends a message. Concurrent writers are serialized
+// so that frames never interleave on the connection.
+func (p *Peer) WriteMessage(message *NetworkMessage) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if len(payload) > MaxMessageSize {
+		return fmt.Errorf("%s message of %d bytes exceeds the %d byte limit", message.Type, len(payload), MaxMessageSize)
+	}
+	if len(message.Type) > commandSize {
+		return fmt.Errorf("message type %s is longer than %d bytes", message.Type, commandSize)
+	}
+
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], p.magic)
+	copy(frame[4:4+commandSize], message.Type)
+	binary.BigEndian.PutUint32(frame[16:20], uint32(len(payload)))
+	checksum := payloadChecksum(payload)
+	copy(frame[20:24], checksum[:])
+	copy(frame[frameHeaderSize:], payload)
+
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+
+	if !p.Connected.Load() {
+		return fmt.Errorf("peer is disconnected")
+	}
+	p.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err = p.Conn.Write(frame)
+	return err
+}
+
+// payloadChecksum returns the first four bytes of the payload's SHA-256
+func payloadChecksum(payload []byte) [4]byte {
+	sum := sha256.Sum256(payload)
+	return [4]byte{sum[0], sum[1], sum[2], sum[3]}
+}
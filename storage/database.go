@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"aetherchain/blockchain"
@@ -53,8 +54,8 @@ func (db *Database) SaveBlockchain() error {
 	// Save blockchain metadata
 	metadata := map[string]interface{}{
 		"height":        len(db.blockchain.Chain),
-		"difficulty":    db.blockchain.Difficulty,
-		"block_reward":  db.blockchain.BlockReward,
+		"genesis_bits":  db.blockchain.GenesisBits,
+		"emission":      db.blockchain.Emission,
 		"last_block":    db.blockchain.GetLastBlock().Hash,
 		"genesis_block": db.blockchain.Chain[0].Hash,
 	}
@@ -65,7 +66,7 @@ func (db *Database) SaveBlockchain() error {
 
 	// Save each block individually
 	for i, block := range db.blockchain.Chain {
-		filename := fmt.Sprintf("block_%d.json", i)
+		filename := fmt.Sprintf("block_%d.dat", i)
 		if err := db.saveBlock(filename, block); err != nil {
 			return fmt.Errorf("failed to save block %d: %v", i, err)
 		}
@@ -81,6 +82,11 @@ func (db *Database) SaveBlockchain() error {
 		return fmt.Errorf("failed to save accounts: %v", err)
 	}
 
+	// Save account nonces
+	if err := db.saveJSON("nonces.json", db.blockchain.Nonces); err != nil {
+		return fmt.Errorf("failed to save nonces: %v", err)
+	}
+
 	fmt.Printf("💾 Blockchain saved: %d blocks, %d pending transactions\n",
 		len(db.blockchain.Chain), len(db.blockchain.TransactionPool))
 
@@ -108,7 +114,7 @@ func (db *Database) LoadBlockchain() error {
 	// Load blocks
 	height := int(metadata["height"].(float64))
 	for i := 0; i < height; i++ {
-		filename := fmt.Sprintf("block_%d.json", i)
+		filename := fmt.Sprintf("block_%d.dat", i)
 		block, err := db.loadBlock(filename)
 		if err != nil {
 			return fmt.Errorf("failed to load block %d: %v", i, err)
@@ -126,29 +132,82 @@ func (db *Database) LoadBlockchain() error {
 		fmt.Printf("⚠️ Could not load accounts: %v\n", err)
 	}
 
+	// Load account nonces, rebuilding them from the chain for older data directories
+	if err := db.loadJSON("nonces.json", &db.blockchain.Nonces); err != nil {
+		fmt.Printf("⚠️ Could not load nonces, rebuilding from chain: %v\n", err)
+		db.blockchain.Nonces = make(map[string]int64)
+		for _, block := range db.blockchain.Chain {
+			if block.Index == 0 {
+				continue // genesis transactions are not signed by a sender
+			}
+			for _, tx := range block.Transactions {
+				if tx.IsCoinbase() {
+					continue
+				}
+				db.blockchain.Nonces[tx.From]++
+			}
+		}
+	}
+
 	fmt.Printf("📖 Blockchain loaded: %d blocks, %d pending transactions\n",
 		len(db.blockchain.Chain), len(db.blockchain.TransactionPool))
 
 	return nil
 }
 
+// PeerAddress records a peer address known to the node's address book
+type PeerAddress struct {
+	Address     string `json:"address"`      // Listen address as host:port
+	Source      string `json:"source"`       // Host the address was learned from
+	Tried       bool   `json:"tried"`        // Whether a connection to it ever succeeded
+	LastSeen    int64  `json:"last_seen"`    // Unix time the address was last advertised
+	LastAttempt int64  `json:"last_attempt"` // Unix time of the last connection attempt
+	LastSuccess int64  `json:"last_success"` // Unix time of the last successful connection
+	Attempts    int    `json:"attempts"`     // Failed attempts since the last success
+}
+
 // SavePeers saves the list of known peers
-func (db *Database) SavePeers(peers []string) error {
+func (db *Database) SavePeers(peers []PeerAddress) error {
 	return db.saveJSON("peers/known_peers.json", peers)
 }
 
 // LoadPeers loads the list of known peers
-func (db *Database) LoadPeers() ([]string, error) {
-	var peers []string
+func (db *Database) LoadPeers() ([]PeerAddress, error) {
+	var peers []PeerAddress
 	if err := db.loadJSON("peers/known_peers.json", &peers); err != nil {
 		if os.IsNotExist(err) {
-			return []string{}, nil
+			return []PeerAddress{}, nil
 		}
 		return nil, err
 	}
 	return peers, nil
 }
 
+// BanEntry records a banned peer host
+type BanEntry struct {
+	Address string `json:"address"` // IP address of the banned host
+	Reason  string `json:"reason"`
+	Created int64  `json:"created"` // Unix time the ban was made
+	Until   int64  `json:"until"`   // Unix time the ban expires
+}
+
+// SaveBans saves the list of banned peers
+func (db *Database) SaveBans(bans []BanEntry) error {
+	return db.saveJSON("peers/banned.json", bans)
+}
+
+// LoadBans loads the list of banned peers
+func (db *Database) LoadBans() ([]BanEntry, error) {
+	var bans []BanEntry
+	if err := db.loadJSON("peers/banned.json", &bans); err != nil {
+		if os.IsNotExist(err) {
+			return []BanEntry{}, nil
+		}
+		return nil, err
+	}
+	return bans, nil
+}
+
 // SaveNodeConfig saves node configuration
 func (db *Database) SaveNodeConfig(config map[string]interface{}) error {
 	return db.saveJSON("node_config.json", config)
@@ -168,13 +227,13 @@ func (db *Database) LoadNodeConfig() (map[string]interface{}, error) {
 
 // SaveBlock saves a single block to disk
 func (db *Database) SaveBlock(block *blockchain.Block) error {
-	filename := fmt.Sprintf("blocks/block_%d.json", block.Index)
+	filename := fmt.Sprintf("blocks/block_%d.dat", block.Index)
 	return db.saveBlock(filename, block)
 }
 
 // LoadBlock loads a single block from disk
 func (db *Database) LoadBlock(height int) (*blockchain.Block, error) {
-	filename := fmt.Sprintf("blocks/block_%d.json", height)
+	filename := fmt.Sprintf("blocks/block_%d.dat", height)
 	return db.loadBlock(filename)
 }
 
@@ -215,27 +274,55 @@ func (db *Database) saveBlock(filename string, block *blockchain.Block) error {
 	}
 	defer file.Close()
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(block)
+	data, err := block.Serialize()
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	return err
 }
 
 func (db *Database) loadBlock(filename string) (*blockchain.Block, error) {
-	path := filepath.Join(db.dataDir, filename)
-	
-	file, err := os.Open(path)
+	data, err := os.ReadFile(filepath.Join(db.dataDir, filename))
+	if os.IsNotExist(err) {
+		return db.migrateLegacyBlock(filename, err)
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	return blockchain.DeserializeBlock(data)
+}
 
+// migrateLegacyBlock reads a block that older versions saved as JSON in
+// place of a missing binary block file, and rewrites it in the binary
+// format. notFound is returned if there is no JSON file either. Blocks hashed
+// by older versions do not match the header and Merkle root derived from
+// their contents today, and cannot be migrated: the chain must be resynced.
+func (db *Database) migrateLegacyBlock(filename string, notFound error) (*blockchain.Block, error) {
+	legacyFilename := strings.TrimSuffix(filename, ".dat") + ".json"
 	var block blockchain.Block
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&block); err != nil {
-		return nil, err
+	if err := db.loadJSON(legacyFilename, &block); err != nil {
+		if os.IsNotExist(err) {
+			return nil, notFound
+		}
+		return nil, fmt.Errorf("failed to read legacy block %s: %v", legacyFilename, err)
 	}
 
-	return &block, nil
+	if block.MerkleRoot != block.CalculateMerkleRoot() || block.Hash != block.CalculateHash() {
+		return nil, fmt.Errorf("legacy block %s does not match its re-derived header, resync required", legacyFilename)
+	}
+
+	if err := db.saveBlock(filename, &block); err != nil {
+		return nil, fmt.Errorf("failed to rewrite legacy block %s: %v", legacyFilename, err)
+	}
+	fmt.Printf("📦 Rewrote legacy block %s as %s\n", legacyFilename, filename)
+
+	// Read it back so the block is exactly what the binary file holds
+	data, err := os.ReadFile(filepath.Join(db.dataDir, filename))
+	if err != nil {
+		return nil, err
+	}
+	return blockchain.DeserializeBlock(data)
 }
 
 // GetDatabaseInfo returns database statistics
@@ -99,10 +99,15 @@ func (sm *StateManager) GetStateInfo() map[string]interface{} {
 }
 
 // calculateTotalBalance calculates the total balance across all accounts
-func (sm *StateManager) calculateTotalBalance() float64 {
-	total := 0.0
+func (sm *StateManager) calculateTotalBalance() blockchain.Amount {
+	var total blockchain.Amount
 	for _, balance := range sm.blockchain.Accounts {
-		total += balance
+		sum, err := total.Add(balance)
+		if err != nil {
+			fmt.Printf("⚠️ Total balance overflows: %v\n", err)
+			return total
+		}
+		total = sum
 	}
 	return total
 }
@@ -166,9 +171,10 @@ func (sm *StateManager) RollbackToHeight(height int) error {
 	// Truncate chain
 	sm.blockchain.Chain = sm.blockchain.Chain[:height+1]
 
-	// Recalculate account states (simplified)
-	// In production, this would rebuild state from the remaining blocks
-	sm.recalculateAccountStates()
+	// Rebuild account states from the remaining blocks
+	if err := sm.recalculateAccountStates(); err != nil {
+		return fmt.Errorf("failed to rebuild state: %v", err)
+	}
 
 	// Save rolled back state
 	if err := sm.database.SaveBlockchain(); err != nil {
@@ -179,19 +185,8 @@ func (sm *StateManager) RollbackToHeight(height int) error {
 }
 
 // recalculateAccountStates recalculates account balances from the current chain
-func (sm *StateManager) recalculateAccountStates() {
-	// Reset accounts
-	sm.blockchain.Accounts = make(map[string]float64)
-
-	// Process all blocks to rebuild account states
-	for _, block := range sm.blockchain.Chain {
-		for _, tx := range block.Transactions {
-			sm.blockchain.Accounts[tx.From] -= tx.Amount + tx.Fee
-			sm.blockchain.Accounts[tx.To] += tx.Amount
-		}
-		// Add miner reward
-		sm.blockchain.Accounts[block.Miner] += block.BlockReward
-	}
+func (sm *StateManager) recalculateAccountStates() error {
+	return sm.blockchain.RebuildState()
 }
 
 // GetStateSnapshot returns a snapshot of the current state
@@ -229,11 +224,14 @@ func (sm *StateManager) VerifyStateIntegrity() (bool, error) {
 		return false, fmt.Errorf("blockchain is invalid")
 	}
 
-	// Verify account balances are non-negative
+	// Verify account balances sum without overflow
+	var total blockchain.Amount
 	for address, balance := range sm.blockchain.Accounts {
-		if balance < 0 {
-			return false, fmt.Errorf("negative balance for address %s: %f", address, balance)
+		sum, err := total.Add(balance)
+		if err != nil {
+			return false, fmt.Errorf("balance of address %s overflows total supply: %s", address, balance)
 		}
+		total = sum
 	}
 
 	// Verify transaction pool integrity